@@ -22,12 +22,31 @@ package autoart
 import (
 	"github.com/pommicket/autoart/autoutils"
 	"io"
+	"math/rand"
 )
 
 func GenerateAudio(output io.Writer, duration float64, sampleRate int32,
-	functionLength int, rectifier int) error {
+	functionLength int, rectifier int, rng *rand.Rand) error {
+	var function autoutils.Function
+	function.Generate(1, functionLength, rng)
+	return GenerateAudioFromFunction(output, duration, sampleRate, &function, rectifier, nil)
+}
+
+// Writes audio made from function (which should take one variable, the time
+// in seconds) to output in WAV format. If m isn't nil, it is embedded in the
+// file's INFO chunk.
+func GenerateAudioFromFunction(output io.Writer, duration float64, sampleRate int32,
+	function *autoutils.Function, rectifier int, m *Manifest) error {
 	samples := int64(duration * float64(sampleRate))
-	err := autoutils.WriteAudioHeader(output, samples, 1, sampleRate)
+	var info []autoutils.InfoEntry
+	if m != nil {
+		metadata, err := m.compactJSON()
+		if err != nil {
+			return err
+		}
+		info = []autoutils.InfoEntry{{ID: "ISFT", Text: "AutoArt"}, {ID: "ICMT", Text: metadata}}
+	}
+	err := autoutils.WriteAudioHeaderInfo(output, samples, 1, sampleRate, info)
 	if err != nil {
 		return err
 	}
@@ -37,13 +56,24 @@ func GenerateAudio(output io.Writer, duration float64, sampleRate int32,
 	sampleBuffer := make([]uint8, sampleBufferSize)
 	sampleBufferIndex := 0
 
-	var function autoutils.Function
-	function.Generate(1, functionLength)
+	compiled := function.Compile()
+	var r autoutils.Interval
+	switch rectifier {
+	case NORMALIZE:
+		r = function.Range([]autoutils.Interval{{Min: 0, Max: duration}}, rangeDivisions*rangeDivisions)
+	case PERCENTILE:
+		values := make([]float64, percentileProbeSize*percentileProbeSize)
+		for i := range values {
+			vars[0] = duration * float64(i) / float64(len(values))
+			values[i] = compiled.Evaluate(vars)
+		}
+		r = percentileRange(values)
+	}
 
 	for s := int64(0); s < samples; s++ {
 		t := float64(s) / float64(sampleRate)
 		vars[0] = t
-		value := rectify(function.Evaluate(vars), rectifier)
+		value := rectifyRange(compiled.Evaluate(vars), rectifier, r)
 		sampleBuffer[sampleBufferIndex] = uint8(255 * value)
 		sampleBufferIndex++
 		if sampleBufferIndex == sampleBufferSize {
@@ -26,11 +26,19 @@ import (
 	"image/color"
 	"math"
 	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
 )
 
 const (
 	XY = iota
 	RTHETA
+	LOGPOLAR
+	ELLIPTIC
+	POINCARE // The hyperbolic plane, in a Poincaré disk
+	FISHEYE
+	CENTERED // XY, centered, and with the same scale in both directions
 )
 
 const (
@@ -39,12 +47,21 @@ const (
 	CMYK
 	HSV
 	YCbCr
+	HSL
+	CIELAB
+	OKLab
+	OKLCh
 )
 
 const (
 	MOD = iota
 	CLAMP
 	SIGMOID
+	NORMALIZE // Maps the estimated range of each function onto 0-1 (see ranges.go)
+	MIRROR    // Like MOD, but goes back down from 1 to 0 instead of jumping
+	TANH
+	SINE       // Like MIRROR, but smooth
+	PERCENTILE // Maps the middle 98% of the values of each function onto 0-1
 )
 
 type Config struct {
@@ -53,6 +70,16 @@ type Config struct {
 	CoordinateSys  int
 	Alpha          bool
 	Rectifier      int // What to do with out-of-bounds values
+	// Which part of the coordinate system is shown (nil for all of it)
+	Viewport *Viewport
+	// The rectifier of each function, or nil to use Rectifier for all of them
+	Rectifiers []int
+	// Which operators the functions are made of (nil for the default)
+	Grammar *autoutils.Grammar
+	// Stops parts of the functions from being hoisted out of the inner loop.
+	// The output is the same either way, so this is only set to measure how
+	// much hoisting helps (see TimeHoisting).
+	noHoisting bool
 }
 
 func sigmoid(x float64) float64 {
@@ -69,12 +96,78 @@ func rectify(x float64, rectifier int) float64 {
 		} else if x < 0 {
 			return 0
 		}
-	case SIGMOID:
+	case MIRROR:
+		// A triangle wave, going from 0 up to 1 and back down every 2
+		m := x - 2*math.Floor(x/2)
+		if m > 1 {
+			return 2 - m
+		}
+		return m
+	case TANH:
+		return 0.5 + 0.5*math.Tanh(x)
+	case SINE:
+		return 0.5 - 0.5*math.Cos(math.Pi*x)
+	case SIGMOID, NORMALIZE, PERCENTILE:
+		// Without a range, NORMALIZE and PERCENTILE are the same as SIGMOID.
 		return sigmoid(x)
 	}
 	return 0
 }
 
+// Like rectify, but NORMALIZE and PERCENTILE map r onto 0-1 (see ranges.go).
+func rectifyRange(x float64, rectifier int, r autoutils.Interval) float64 {
+	if rectifier == NORMALIZE || rectifier == PERCENTILE {
+		return normalize(x, r)
+	}
+	return rectify(x, rectifier)
+}
+
+// Returns the derivative of rectifyRange(x, rectifier, r) with respect to x,
+// ignoring the jumps of the modulo.
+func rectifierSlope(x float64, rectifier int, r autoutils.Interval) float64 {
+	switch rectifier {
+	case MOD:
+		return 1
+	case CLAMP:
+		return 0
+	case MIRROR:
+		if x-2*math.Floor(x/2) > 1 {
+			return -1
+		}
+		return 1
+	case TANH:
+		t := math.Tanh(x)
+		return 0.5 * (1 - t*t)
+	case SINE:
+		return 0.5 * math.Pi * math.Sin(math.Pi*x)
+	case NORMALIZE, PERCENTILE:
+		if r.Bounded() && r.Max != r.Min {
+			if x < r.Min || x > r.Max {
+				return 0
+			}
+			return 1 / (r.Max - r.Min)
+		}
+		fallthrough
+	case SIGMOID:
+		s := sigmoid(x)
+		return s * (1 - s)
+	}
+	return 0
+}
+
+// Returns the rectifiers of n functions. If conf doesn't have a rectifier for
+// each of them, they all use conf.Rectifier.
+func (conf *Config) rectifiers(n int) []int {
+	if len(conf.Rectifiers) == n {
+		return conf.Rectifiers
+	}
+	rectifiers := make([]int, n)
+	for i := range rectifiers {
+		rectifiers[i] = conf.Rectifier
+	}
+	return rectifiers
+}
+
 func (conf *Config) nFunctions() int {
 	a := 0
 	if conf.Alpha {
@@ -83,66 +176,113 @@ func (conf *Config) nFunctions() int {
 	switch conf.ColorSpace {
 	case GRAYSCALE:
 		return a + 1
-	case RGB, HSV, YCbCr:
+	case RGB, HSV, YCbCr, HSL, CIELAB, OKLab, OKLCh:
 		return a + 3
 	case CMYK:
 		return a + 4
 	}
 	panic("Invalid color space!")
-	return a
 }
 
 const defaultFunctionLength = 40
 
+func compileFunctions(functions []autoutils.Function) []*autoutils.CompiledFunction {
+	compiled := make([]*autoutils.CompiledFunction, len(functions))
+	for i := range functions {
+		compiled[i] = functions[i].Compile()
+	}
+	return compiled
+}
+
+/*
+Calls the function returned by newWorker for every row from 0 to height-1.
+The rows are split between GOMAXPROCS goroutines, and newWorker is called
+once in each goroutine, so it can set up anything that can't be shared between
+goroutines (e.g. compiled functions).
+*/
+func parallelRows(height int, newWorker func() func(y int)) {
+	workers := runtime.GOMAXPROCS(0)
+	if workers > height {
+		workers = height
+	}
+	var next int64 = -1
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+			renderRow := newWorker()
+			for {
+				y := int(atomic.AddInt64(&next, 1))
+				if y >= height {
+					return
+				}
+				renderRow(y)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
 func GenerateImageFromFunctions(width int, height int, config Config,
 	functions []autoutils.Function,
 	vars []float64) image.Image {
+	h := newHoister(functions, config.pixelMap(), width, height, false, !config.noHoisting)
+	return renderImage(width, height, config, h.frame(vars))
+}
+
+func renderImage(width int, height int, config Config, frame *hoistedFrame) image.Image {
 	var rect = image.Rectangle{image.Point{0, 0}, image.Point{width, height}}
 	img := image.NewRGBA(rect)
 	colorSpace := config.ColorSpace
 	alpha := config.Alpha
-	rectifier := config.Rectifier
-	nfunctions := len(functions)
-	rets := make([]uint8, nfunctions)
-	fwidth, fheight := float64(width), float64(height)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			switch config.CoordinateSys {
-			case XY:
-				vars[0], vars[1] = float64(x)/fwidth, float64(y)/fheight
-			case RTHETA:
-				dx, dy := float64(x-width/2), float64(y-height/2)
-				vars[0] = math.Sqrt(dx*dx+dy*dy) / ((fwidth + fheight) / 2) // r
-				vars[1] = math.Atan2(dy, dx)                                // theta
-			}
-			for i := range rets {
-				ret := rectify(functions[i].Evaluate(vars), rectifier)
-				rets[i] = uint8(255 * ret)
-			}
-			var r, g, b, a uint8
-			a = 255
-			switch colorSpace {
-			case RGB:
-				r, g, b = rets[0], rets[1], rets[2]
-			case GRAYSCALE:
-				r, g, b = rets[0], rets[0], rets[0]
-			case CMYK:
-				r, g, b = color.CMYKToRGB(rets[0], rets[1], rets[2], rets[3])
-			case HSV:
-				r, g, b = autoutils.HSVToRGB(rets[0], rets[1], rets[2])
-			case YCbCr:
-				r, g, b = color.YCbCrToRGB(rets[0], rets[1], rets[2])
-			}
-			if alpha {
-				a = rets[nfunctions-1]
+	rectifiers := config.rectifiers(len(frame.h.functions))
+	nfunctions := len(frame.h.functions)
+	ranges := frame.rectifierRanges(rectifiers)
+	parallelRows(height, func() func(y int) {
+		evaluate := frame.evaluator()
+		rets := make([]uint8, nfunctions)
+		return func(y int) {
+			row := img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				for i := range rets {
+					ret := rectifyRange(evaluate(i, x, y), rectifiers[i], ranges[i])
+					rets[i] = uint8(255 * ret)
+				}
+				var r, g, b, a uint8
+				a = 255
+				switch colorSpace {
+				case RGB:
+					r, g, b = rets[0], rets[1], rets[2]
+				case GRAYSCALE:
+					r, g, b = rets[0], rets[0], rets[0]
+				case CMYK:
+					r, g, b = color.CMYKToRGB(rets[0], rets[1], rets[2], rets[3])
+				case HSV:
+					r, g, b = autoutils.HSVToRGB(rets[0], rets[1], rets[2])
+				case YCbCr:
+					r, g, b = color.YCbCrToRGB(rets[0], rets[1], rets[2])
+				case HSL:
+					r, g, b = autoutils.HSLToRGB(rets[0], rets[1], rets[2])
+				case CIELAB:
+					r, g, b = autoutils.CIELABToRGB(rets[0], rets[1], rets[2])
+				case OKLab:
+					r, g, b = autoutils.OKLabToRGB(rets[0], rets[1], rets[2])
+				case OKLCh:
+					r, g, b = autoutils.OKLChToRGB(rets[0], rets[1], rets[2])
+				}
+				if alpha {
+					a = rets[nfunctions-1]
+				}
+				row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = r, g, b, a
 			}
-			img.Set(x, y, color.RGBA{r, g, b, a})
 		}
-	}
+	})
 	return img
 }
 
-func GenerateImage(width int, height int, config Config) image.Image {
+// Returns random functions with nvars variables for config.
+func randomFunctions(nvars int, config Config, rng *rand.Rand) []autoutils.Function {
 	if config.FunctionLength == 0 {
 		// 0 value of config shouldn't have empty functions
 		config.FunctionLength = defaultFunctionLength
@@ -153,22 +293,30 @@ func GenerateImage(width int, height int, config Config) image.Image {
 	nfunctions := config.nFunctions()
 	functions := make([]autoutils.Function, nfunctions)
 	for i := range functions {
-		functions[i].Generate(2, functionLength)
+		functions[i].GenerateWith(config.Grammar, nvars, functionLength, rng)
 	}
+	return functions
+}
+
+func GenerateImage(width int, height int, config Config, rng *rand.Rand) image.Image {
+	functions := randomFunctions(2, config, rng)
 	vars := []float64{0, 0}
 	return GenerateImageFromFunctions(width, height, config, functions, vars)
 }
 
-func GenerateImages(width int, height int, config Config, number int, verbose bool) []image.Image {
-	c := make(chan image.Image)
+// Generates number images. Image i is generated using
+// autoutils.ItemRand(seed, i).
+func GenerateImages(width int, height int, config Config, number int, seed int64, verbose bool) []image.Image {
+	c := make(chan int)
+	imgs := make([]image.Image, number)
 	for i := 0; i < number; i++ {
-		go func() {
-			c <- GenerateImage(width, height, config)
-		}()
+		go func(i int) {
+			imgs[i] = GenerateImage(width, height, config, autoutils.ItemRand(seed, int64(i)))
+			c <- i
+		}(i)
 	}
-	imgs := make([]image.Image, number)
 	for i := range imgs {
-		imgs[i] = <-c
+		<-c
 		if verbose {
 			fmt.Println("Generating images...", i+1, "/", number)
 		}
@@ -181,75 +329,93 @@ type PaletteConfig struct {
 	Alpha          bool
 	FunctionLength int
 	CoordinateSys  int
+	Grammar        *autoutils.Grammar
+	// Which part of the coordinate system is shown (nil for all of it)
+	Viewport *Viewport
+	// See Config.noHoisting
+	noHoisting bool
 }
 
 func GenerateImagePaletteFrom(width int, height int, conf PaletteConfig,
 	funcs []autoutils.Function, vars []float64,
 	palette []color.RGBA) image.Image {
+	h := newHoister(funcs, conf.pixelMap(), width, height, false, !conf.noHoisting)
+	return renderImagePalette(width, height, conf, h.frame(vars), palette)
+}
+
+func renderImagePalette(width int, height int, conf PaletteConfig,
+	frame *hoistedFrame, palette []color.RGBA) image.Image {
 	img := image.NewRGBA(image.Rectangle{image.Point{0, 0}, image.Point{width, height}})
-	fwidth, fheight := float64(width), float64(height)
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			switch conf.CoordinateSys {
-			case XY:
-				vars[0], vars[1] = float64(x)/fwidth, float64(y)/fheight
-			case RTHETA:
-				dx, dy := float64(x-width/2), float64(y-height/2)
-				vars[0] = math.Sqrt(dx*dx+dy*dy) / ((fwidth + fheight) / 2) // r
-				vars[1] = math.Atan2(dy, dx)                                // theta
-			}
-			for i := range palette {
-				if i == conf.NColors-1 {
-					// Background color
-					img.Set(x, y, palette[i])
-				} else if funcs[i].Evaluate(vars) < 0 {
-					img.Set(x, y, palette[i])
-					break
+	parallelRows(height, func() func(y int) {
+		evaluate := frame.evaluator()
+		return func(y int) {
+			row := img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				for i, c := range palette {
+					if i == conf.NColors-1 || evaluate(i, x, y) < 0 {
+						// The last color is the background color
+						row[4*x], row[4*x+1], row[4*x+2], row[4*x+3] = c.R, c.G, c.B, c.A
+						break
+					}
 				}
 			}
 		}
-	}
+	})
 	return img
 }
 
-func GenerateImagePalette(width int, height int, conf PaletteConfig) image.Image {
-	nColors := conf.NColors
-	alpha := conf.Alpha
-	functionLength := conf.FunctionLength
-
-	funcs := make([]autoutils.Function, nColors-1)
-	palette := make([]color.RGBA, nColors)
-
-	// Choose palette
+// Returns ncolors random colors. If alpha is false, they will all be opaque.
+func randomPalette(rng *rand.Rand, ncolors int, alpha bool) []color.RGBA {
+	palette := make([]color.RGBA, ncolors)
 	for i := range palette {
-		r, g, b := rand.Intn(256), rand.Intn(256), rand.Intn(256)
+		r, g, b := rng.Intn(256), rng.Intn(256), rng.Intn(256)
 		var a int
 		if alpha {
-			a = rand.Intn(256)
+			a = rng.Intn(256)
 		} else {
 			a = 255
 		}
 		palette[i] = color.RGBA{uint8(r), uint8(g), uint8(b), uint8(a)}
 	}
+	return palette
+}
+
+// Returns a random palette and random functions with nvars variables for conf.
+func randomPaletteFunctions(nvars int, conf PaletteConfig, rng *rand.Rand) ([]color.RGBA, []autoutils.Function) {
+	nColors := conf.NColors
+	alpha := conf.Alpha
+	functionLength := conf.FunctionLength
+
+	funcs := make([]autoutils.Function, nColors-1)
+
+	// Choose palette
+	palette := randomPalette(rng, nColors, alpha)
 	// Choose functions
 	for i := range funcs {
-		funcs[i].Generate(2, functionLength)
+		funcs[i].GenerateWith(conf.Grammar, nvars, functionLength, rng)
 	}
+	return palette, funcs
+}
 
+func GenerateImagePalette(width int, height int, conf PaletteConfig, rng *rand.Rand) image.Image {
+	palette, funcs := randomPaletteFunctions(2, conf, rng)
 	vars := make([]float64, 2)
 	return GenerateImagePaletteFrom(width, height, conf, funcs, vars, palette)
 }
 
-func GenerateImagesPalette(width int, height int, conf PaletteConfig, number int, verbose bool) []image.Image {
-	c := make(chan image.Image)
+// Generates number images. Image i is generated using
+// autoutils.ItemRand(seed, i).
+func GenerateImagesPalette(width int, height int, conf PaletteConfig, number int, seed int64, verbose bool) []image.Image {
+	c := make(chan int)
+	images := make([]image.Image, number)
 	for i := 0; i < number; i++ {
-		go func() {
-			c <- GenerateImagePalette(width, height, conf)
-		}()
+		go func(i int) {
+			images[i] = GenerateImagePalette(width, height, conf, autoutils.ItemRand(seed, int64(i)))
+			c <- i
+		}(i)
 	}
-	images := make([]image.Image, number)
 	for i := 0; i < number; i++ {
-		images[i] = <-c
+		<-c
 		if verbose {
 			fmt.Println("Generating images...", i+1, "/", number)
 		}
@@ -34,18 +34,19 @@ import (
 	"math/rand"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 func generateFrame(width int, height int, paletted bool, config Config,
 	pconfig PaletteConfig, palette []color.RGBA,
-	functions []autoutils.Function, time float64,
+	h *hoister, time float64,
 	frameNumber int64, file *os.File) error { // NOTE: file is closed by this function
-	vars := []float64{0, 0, time}
+	frame := h.frame([]float64{0, 0, time})
 	var img image.Image
 	if paletted {
-		img = GenerateImagePaletteFrom(width, height, pconfig, functions, vars, palette)
+		img = renderImagePalette(width, height, pconfig, frame, palette)
 	} else {
-		img = GenerateImageFromFunctions(width, height, config, functions, vars)
+		img = renderImage(width, height, config, frame)
 	}
 	if err := png.Encode(file, img); err != nil {
 		file.Close()
@@ -56,47 +57,18 @@ func generateFrame(width int, height int, paletted bool, config Config,
 
 func generateVideo(width int, height int, paletted bool, config Config,
 	pconfig PaletteConfig, time float64,
-	framerate int, filename string, verbose bool) error {
-
-	var palette []color.RGBA
-	if paletted {
-		// Generate palette
-		palette = make([]color.RGBA, pconfig.NColors)
-		for i := range palette {
-			r := uint8(rand.Intn(256))
-			g := uint8(rand.Intn(256))
-			b := uint8(rand.Intn(256))
-			a := uint8(255)
-			if pconfig.Alpha {
-				a = uint8(rand.Intn(256))
-			}
-			palette[i] = color.RGBA{r, g, b, a}
-		}
-	}
-
-	if config.FunctionLength == 0 {
-		// 0 value of config shouldn't have empty functions
-		config.FunctionLength = defaultFunctionLength
-	}
-
-	var functionLength int
-	if paletted {
-		functionLength = pconfig.FunctionLength
-	} else {
-		functionLength = config.FunctionLength
-	}
-
-	var nfunctions int
-	if paletted {
-		nfunctions = pconfig.NColors
-	} else {
-		nfunctions = config.nFunctions()
-	}
-	functions := make([]autoutils.Function, nfunctions)
-	for i := range functions {
-		functions[i].Generate(3, functionLength)
-	}
+	framerate int, filename string, verbose bool, rng *rand.Rand) error {
+	g := RandomGenome(3, paletted, config, pconfig, rng)
+	return g.Video(width, height, time, framerate, filename, verbose, nil)
+}
 
+// Renders a video of the given functions (which should have 3 variables: x, y,
+// and t) to filename, using ffmpeg. If metadata isn't empty, it is stored in
+// the video's comment.
+func renderVideo(width int, height int, paletted bool, config Config,
+	pconfig PaletteConfig, palette []color.RGBA,
+	functions []autoutils.Function, time float64,
+	framerate int, filename string, verbose bool, metadata string) error {
 	frames := int64(time * float64(framerate))
 
 	files := make([]*os.File, frames)
@@ -117,10 +89,22 @@ func generateVideo(width int, height int, paletted bool, config Config,
 		}
 	}
 
-	autoutils.RunInBatches(frames, "Generating video...", func(n int64, errs chan<- error) {
+	m, hoist := config.pixelMap(), !config.noHoisting
+	if paletted {
+		m, hoist = pconfig.pixelMap(), !pconfig.noHoisting
+	}
+	// Parts of the functions which don't depend on time are only evaluated once.
+	h := newHoister(functions, m, width, height, true, hoist)
+	if !paletted {
+		h.setVideoRanges(time, config.rectifiers(len(functions)))
+	}
+	err := autoutils.RunInBatches(frames, "Generating video...", func(n int64, errs chan<- error) {
 		t := float64(n) / float64(framerate)
-		errs <- generateFrame(width, height, paletted, config, pconfig, palette, functions, t, n, files[n])
+		errs <- generateFrame(width, height, paletted, config, pconfig, palette, h, t, n, files[n])
 	})
+	if err != nil {
+		return err
+	}
 
 	ffmpegInputFile, err := ioutil.TempFile("", "input*.txt")
 	if err != nil {
@@ -142,11 +126,16 @@ func generateVideo(width int, height int, paletted bool, config Config,
 		return err
 	}
 
+	args := []string{"-y", "-f", "concat", "-safe", "0", "-i", ffmpegInputFile.Name()}
+	if metadata != "" {
+		args = append(args, "-metadata", "comment="+metadata)
+	}
+	args = append(args, filename)
 	if verbose {
-		fmt.Println("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", ffmpegInputFile.Name(), filename)
+		fmt.Println("ffmpeg", strings.Join(args, " "))
 	}
 
-	cmd := exec.Command("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", ffmpegInputFile.Name(), filename)
+	cmd := exec.Command("ffmpeg", args...)
 	if verbose {
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
@@ -159,13 +148,13 @@ func generateVideo(width int, height int, paletted bool, config Config,
 }
 
 func GenerateVideo(width int, height int, config Config, time float64,
-	framerate int, filename string, verbose bool) error {
+	framerate int, filename string, verbose bool, rng *rand.Rand) error {
 	var pconfig PaletteConfig
-	return generateVideo(width, height, false, config, pconfig, time, framerate, filename, verbose)
+	return generateVideo(width, height, false, config, pconfig, time, framerate, filename, verbose, rng)
 }
 
 func GenerateVideoPalette(width int, height int, pconfig PaletteConfig,
-	time float64, framerate int, filename string, verbose bool) error {
+	time float64, framerate int, filename string, verbose bool, rng *rand.Rand) error {
 	var config Config
-	return generateVideo(width, height, true, config, pconfig, time, framerate, filename, verbose)
+	return generateVideo(width, height, true, config, pconfig, time, framerate, filename, verbose, rng)
 }
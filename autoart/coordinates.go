@@ -0,0 +1,457 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"math"
+	"strings"
+)
+
+/*
+A CoordinateSystem maps the pixels of an image to the two variables the
+functions take (other than t). Coordinate systems are used by their number in
+Config and PaletteConfig; the built-in ones are XY, RTHETA, etc., and others
+can be added with RegisterCoordinateSys.
+
+A coordinate system can also implement ShaderCoordinateSystem, so genomes using
+it can be written as shaders, and DifferentiableCoordinateSystem, so relief is
+more accurate.
+*/
+type CoordinateSystem interface {
+	// Returns the variables at the point (x, y) of a width by height image.
+	// x and y are in pixels, from the top left, but aren't always whole
+	// numbers.
+	Coordinates(x float64, y float64, width int, height int) (float64, float64)
+	// Returns intervals containing the variables at every pixel, for any
+	// size of image. They can be infinite, but then the NORMALIZE rectifier
+	// won't work well.
+	Domain() []autoutils.Interval
+	// The names of the variables, as text (which can include any Unicode) and
+	// as LaTeX
+	VarNames() []string
+	VarLaTeX() []string
+}
+
+type ShaderCoordinateSystem interface {
+	CoordinateSystem
+	// The names of the variables in GLSL
+	GLSLVarNames() []string
+	// Returns GLSL statements which declare the variables (as floats) at the
+	// point (px, py) of an image which is aa_width by aa_height pixels (the
+	// floats passed to Coordinates). Any other names declared should start
+	// with aa_.
+	GLSL() string
+}
+
+type DifferentiableCoordinateSystem interface {
+	CoordinateSystem
+	// Returns the derivatives of the variables at (x, y) with respect to x
+	// and y.
+	Jacobian(x float64, y float64, width int, height int) (v0x float64, v0y float64, v1x float64, v1y float64)
+}
+
+// A built-in coordinate system
+type builtinCoordinates struct {
+	coordinates func(x float64, y float64, width int, height int) (float64, float64)
+	// nil to use numericJacobian
+	jacobian  func(x float64, y float64, width int, height int) (float64, float64, float64, float64)
+	domain    []autoutils.Interval
+	names     []string
+	latex     []string
+	glslNames []string
+	glsl      string
+	// Whether the first variable only depends on x and the second only on y
+	// (see cacheSets)
+	separable bool
+}
+
+func (c *builtinCoordinates) Coordinates(x float64, y float64, width int, height int) (float64, float64) {
+	return c.coordinates(x, y, width, height)
+}
+
+func (c *builtinCoordinates) Domain() []autoutils.Interval {
+	return c.domain
+}
+
+func (c *builtinCoordinates) VarNames() []string {
+	return c.names
+}
+
+func (c *builtinCoordinates) VarLaTeX() []string {
+	return c.latex
+}
+
+func (c *builtinCoordinates) GLSLVarNames() []string {
+	return c.glslNames
+}
+
+func (c *builtinCoordinates) GLSL() string {
+	return c.glsl
+}
+
+func (c *builtinCoordinates) Jacobian(x float64, y float64, width int, height int) (float64, float64, float64, float64) {
+	if c.jacobian == nil {
+		return numericJacobian(c, x, y, width, height)
+	}
+	return c.jacobian(x, y, width, height)
+}
+
+const (
+	// The smallest r log-polar coordinates use, so the center isn't -∞
+	logPolarMinRadius = 1e-3
+	// The distance of the foci of elliptic coordinates from the center
+	ellipticFocus = 0.5
+	// The furthest points of the Poincaré disk from its center which are used
+	// (the edge is infinitely far away)
+	poincareMaxRadius = 0.99
+)
+
+// Returns the position of (x, y) relative to the center of the image, in units
+// of scale pixels.
+func centered(x float64, y float64, width int, height int, scale float64) (float64, float64) {
+	return (x - float64(width)/2) / scale, (y - float64(height)/2) / scale
+}
+
+// Polar coordinates, with r in units of the average of the width and height
+func polar(x float64, y float64, width int, height int) (float64, float64) {
+	dx, dy := x-float64(width/2), y-float64(height/2)
+	return math.Sqrt(dx*dx+dy*dy) / (float64(width+height) / 2), math.Atan2(dy, dx)
+}
+
+const shaderPolar = `	float aa_dx = px - floor(aa_width / 2.0);
+	float aa_dy = py - floor(aa_height / 2.0);
+	float aa_r = sqrt(aa_dx * aa_dx + aa_dy * aa_dy) / ((aa_width + aa_height) / 2.0);
+	float theta = aa_atan2(aa_dy, aa_dx);
+`
+
+var coordinateSystems = []CoordinateSystem{
+	XY: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			return x / float64(width), y / float64(height)
+		},
+		jacobian: func(x float64, y float64, width int, height int) (float64, float64, float64, float64) {
+			return 1 / float64(width), 0, 0, 1 / float64(height)
+		},
+		domain:    []autoutils.Interval{{Min: 0, Max: 1}, {Min: 0, Max: 1}},
+		names:     []string{"x", "y"},
+		latex:     []string{"x", "y"},
+		glslNames: []string{"x", "y"},
+		glsl:      "\tfloat x = px / aa_width;\n\tfloat y = py / aa_height;\n",
+		separable: true,
+	},
+	RTHETA: &builtinCoordinates{
+		coordinates: polar,
+		jacobian: func(x float64, y float64, width int, height int) (float64, float64, float64, float64) {
+			dx, dy := x-float64(width/2), y-float64(height/2)
+			dist2 := dx*dx + dy*dy
+			if dist2 == 0 {
+				// r and theta aren't differentiable at the center
+				return 0, 0, 0, 0
+			}
+			dist := math.Sqrt(dist2)
+			scale := float64(width+height) / 2
+			return dx / (dist * scale), dy / (dist * scale), -dy / dist2, dx / dist2
+		},
+		// r is at most sqrt(w² + h²) / 2 / ((w + h) / 2), which is less than 1.
+		domain:    []autoutils.Interval{{Min: 0, Max: 1}, {Min: -math.Pi, Max: math.Pi}},
+		names:     []string{"r", "θ"},
+		latex:     []string{"r", `\theta`},
+		glslNames: []string{"r", "theta"},
+		glsl:      shaderPolar + "\tfloat r = aa_r;\n",
+	},
+	LOGPOLAR: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			r, theta := polar(x, y, width, height)
+			return math.Log(math.Max(r, logPolarMinRadius)), theta
+		},
+		domain:    []autoutils.Interval{{Min: math.Log(logPolarMinRadius), Max: 0}, {Min: -math.Pi, Max: math.Pi}},
+		names:     []string{"ρ", "θ"},
+		latex:     []string{`\rho`, `\theta`},
+		glslNames: []string{"rho", "theta"},
+		glsl:      shaderPolar + fmt.Sprintf("\tfloat rho = log(max(aa_r, %s));\n", autoutils.GLSLFloat(logPolarMinRadius)),
+	},
+	ELLIPTIC: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			u, v := centered(x, y, width, height, math.Max(float64(width), float64(height))/2)
+			d1 := math.Hypot(u+ellipticFocus, v)
+			d2 := math.Hypot(u-ellipticFocus, v)
+			mu := math.Acosh(math.Max(1, (d1+d2)/(2*ellipticFocus)))
+			nu := math.Acos(math.Max(-1, math.Min(1, (d1-d2)/(2*ellipticFocus))))
+			if v < 0 {
+				nu = -nu
+			}
+			return mu, nu
+		},
+		// At the corners, which are furthest from the foci, μ = acosh((√1.25 + √3.25) / 1) < 2.
+		domain:    []autoutils.Interval{{Min: 0, Max: 2}, {Min: -math.Pi, Max: math.Pi}},
+		names:     []string{"μ", "ν"},
+		latex:     []string{`\mu`, `\nu`},
+		glslNames: []string{"mu", "nu"},
+		glsl: fmt.Sprintf(`	float aa_s = max(aa_width, aa_height) / 2.0;
+	float aa_u = (px - aa_width / 2.0) / aa_s;
+	float aa_v = (py - aa_height / 2.0) / aa_s;
+	float aa_d1 = sqrt((aa_u + %[1]s) * (aa_u + %[1]s) + aa_v * aa_v);
+	float aa_d2 = sqrt((aa_u - %[1]s) * (aa_u - %[1]s) + aa_v * aa_v);
+	float mu = acosh(max(1.0, (aa_d1 + aa_d2) / (2.0 * %[1]s)));
+	float nu = acos(clamp((aa_d1 - aa_d2) / (2.0 * %[1]s), -1.0, 1.0));
+	if (aa_v < 0.0) nu = -nu;
+`, autoutils.GLSLFloat(ellipticFocus)),
+	},
+	POINCARE: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			u, v := centered(x, y, width, height, math.Min(float64(width), float64(height))/2)
+			r2 := u*u + v*v
+			if r2 > 1 {
+				// Outside of the disk, reflect it back in
+				u, v, r2 = u/r2, v/r2, 1/r2
+			}
+			if r2 > poincareMaxRadius*poincareMaxRadius {
+				scale := poincareMaxRadius / math.Sqrt(r2)
+				u, v, r2 = u*scale, v*scale, poincareMaxRadius*poincareMaxRadius
+			}
+			// The point of the hyperboloid model it's a projection of
+			return 2 * u / (1 - r2), 2 * v / (1 - r2)
+		},
+		// 2 * 0.99 / (1 - 0.99²) < 100
+		domain:    []autoutils.Interval{{Min: -100, Max: 100}, {Min: -100, Max: 100}},
+		names:     []string{"u", "v"},
+		latex:     []string{"u", "v"},
+		glslNames: []string{"u", "v"},
+		glsl: fmt.Sprintf(`	float aa_s = min(aa_width, aa_height) / 2.0;
+	float aa_u = (px - aa_width / 2.0) / aa_s;
+	float aa_v = (py - aa_height / 2.0) / aa_s;
+	float aa_r2 = aa_u * aa_u + aa_v * aa_v;
+	if (aa_r2 > 1.0) {
+		aa_u /= aa_r2;
+		aa_v /= aa_r2;
+		aa_r2 = 1.0 / aa_r2;
+	}
+	if (aa_r2 > %[1]s * %[1]s) {
+		float aa_scale = %[1]s / sqrt(aa_r2);
+		aa_u *= aa_scale;
+		aa_v *= aa_scale;
+		aa_r2 = %[1]s * %[1]s;
+	}
+	float u = 2.0 * aa_u / (1.0 - aa_r2);
+	float v = 2.0 * aa_v / (1.0 - aa_r2);
+`, autoutils.GLSLFloat(poincareMaxRadius)),
+	},
+	FISHEYE: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			u, v := centered(x, y, width, height, math.Min(float64(width), float64(height))/2)
+			// An equidistant fisheye lens, which sees 180° across the largest
+			// circle which fits in the image
+			r := math.Sqrt(u*u + v*v)
+			dx, dy, dz := 0.0, 0.0, 1.0
+			if r > 0 {
+				angle := r * math.Pi / 2
+				dx, dy, dz = math.Sin(angle)*u/r, math.Sin(angle)*v/r, math.Cos(angle)
+			}
+			// The longitude and latitude of the direction
+			return math.Atan2(dx, dz), math.Asin(math.Max(-1, math.Min(1, dy)))
+		},
+		domain:    []autoutils.Interval{{Min: -math.Pi, Max: math.Pi}, {Min: -math.Pi / 2, Max: math.Pi / 2}},
+		names:     []string{"λ", "φ"},
+		latex:     []string{`\lambda`, `\varphi`},
+		glslNames: []string{"lambda", "phi"},
+		glsl: `	float aa_s = min(aa_width, aa_height) / 2.0;
+	float aa_u = (px - aa_width / 2.0) / aa_s;
+	float aa_v = (py - aa_height / 2.0) / aa_s;
+	float aa_r = sqrt(aa_u * aa_u + aa_v * aa_v);
+	float aa_dx = 0.0, aa_dy = 0.0, aa_dz = 1.0;
+	if (aa_r > 0.0) {
+		float aa_angle = aa_r * 1.5707963267948966;
+		aa_dx = sin(aa_angle) * aa_u / aa_r;
+		aa_dy = sin(aa_angle) * aa_v / aa_r;
+		aa_dz = cos(aa_angle);
+	}
+	float lambda = aa_atan2(aa_dx, aa_dz);
+	float phi = asin(clamp(aa_dy, -1.0, 1.0));
+`,
+	},
+	CENTERED: &builtinCoordinates{
+		coordinates: func(x float64, y float64, width int, height int) (float64, float64) {
+			return centered(x, y, width, height, math.Max(float64(width), float64(height))/2)
+		},
+		jacobian: func(x float64, y float64, width int, height int) (float64, float64, float64, float64) {
+			scale := math.Max(float64(width), float64(height)) / 2
+			return 1 / scale, 0, 0, 1 / scale
+		},
+		domain:    []autoutils.Interval{{Min: -1, Max: 1}, {Min: -1, Max: 1}},
+		names:     []string{"x", "y"},
+		latex:     []string{"x", "y"},
+		glslNames: []string{"x", "y"},
+		glsl: `	float aa_s = max(aa_width, aa_height) / 2.0;
+	float x = (px - aa_width / 2.0) / aa_s;
+	float y = (py - aa_height / 2.0) / aa_s;
+`,
+		separable: true,
+	},
+}
+
+// Descriptions of the coordinate systems, for prompts
+var CoordinateSysDescriptions = []string{
+	XY:       "x, y",
+	RTHETA:   "r, theta (polar)",
+	LOGPOLAR: "log r, theta (log-polar)",
+	ELLIPTIC: "mu, nu (elliptic, with foci left and right of the center)",
+	POINCARE: "u, v (the hyperbolic plane, in a Poincaré disk)",
+	FISHEYE:  "longitude, latitude (a panorama seen through a fisheye lens)",
+	CENTERED: "x, y from -1 to 1, centered, and not stretched to fit the image",
+}
+
+/*
+Adds a coordinate system, with the given name (for command line flags, presets,
+etc.) and description (for prompts), and returns its number, which can be used
+as the CoordinateSys of a Config or PaletteConfig. This isn't safe to call while
+anything is being rendered, so it's best called from an init function.
+*/
+func RegisterCoordinateSys(name string, description string, cs CoordinateSystem) (int, error) {
+	if len(cs.Domain()) != 2 || len(cs.VarNames()) != 2 || len(cs.VarLaTeX()) != 2 {
+		return 0, fmt.Errorf("coordinate system %q should have 2 variables", name)
+	}
+	for _, n := range CoordinateSysNames {
+		if strings.EqualFold(n, name) {
+			return 0, fmt.Errorf("there is already a coordinate system called %q", name)
+		}
+	}
+	coordinateSystems = append(coordinateSystems, cs)
+	CoordinateSysNames = append(CoordinateSysNames, name)
+	CoordinateSysDescriptions = append(CoordinateSysDescriptions, description)
+	return len(coordinateSystems) - 1, nil
+}
+
+// Returns the coordinate system with the given number, or nil if there isn't
+// one.
+func CoordinateSys(n int) CoordinateSystem {
+	if n < 0 || n >= len(coordinateSystems) {
+		return nil
+	}
+	return coordinateSystems[n]
+}
+
+// Approximates the Jacobian of cs at (x, y) with finite differences. On each
+// side, the smaller difference is used, so jumps in the variables (e.g. of θ
+// from π to -π) are ignored.
+func numericJacobian(cs CoordinateSystem, x float64, y float64, width int, height int) (float64, float64, float64, float64) {
+	const step = 1e-3
+	derivative := func(dx float64, dy float64) (float64, float64) {
+		v0, v1 := cs.Coordinates(x, y, width, height)
+		f0, f1 := cs.Coordinates(x+dx, y+dy, width, height)
+		b0, b1 := cs.Coordinates(x-dx, y-dy, width, height)
+		smaller := func(a float64, b float64) float64 {
+			if math.Abs(a) < math.Abs(b) {
+				return a
+			}
+			return b
+		}
+		return smaller(f0-v0, v0-b0) / step, smaller(f1-v1, v1-b1) / step
+	}
+	v0x, v1x := derivative(step, 0)
+	v0y, v1y := derivative(0, step)
+	return v0x, v0y, v1x, v1y
+}
+
+// How the pixels of an image are mapped to the variables: a coordinate system,
+// seen through a viewport
+type pixelMap struct {
+	sys CoordinateSystem
+	// nil to show the whole canvas (see Viewport)
+	viewport *Viewport
+}
+
+func (c *Config) pixelMap() pixelMap {
+	return pixelMap{coordinateSystems[c.CoordinateSys], c.Viewport}
+}
+
+func (c *PaletteConfig) pixelMap() pixelMap {
+	return pixelMap{coordinateSystems[c.CoordinateSys], c.Viewport}
+}
+
+// The number of the coordinate system of g's functions
+func (g *Genome) coordinateSys() int {
+	if g.Paletted {
+		return g.PaletteConfig.CoordinateSys
+	}
+	return g.Config.CoordinateSys
+}
+
+func (g *Genome) pixelMap() pixelMap {
+	if g.Paletted {
+		return g.PaletteConfig.pixelMap()
+	}
+	return g.Config.pixelMap()
+}
+
+// Sets vars[0] and vars[1] to the coordinates of the pixel (x, y).
+func (m pixelMap) set(vars []float64, x int, y int, width int, height int) {
+	if m.viewport == nil {
+		vars[0], vars[1] = m.sys.Coordinates(float64(x), float64(y), width, height)
+		return
+	}
+	cx, cy, cwidth, cheight := m.viewport.transform(float64(x), float64(y), width, height)
+	vars[0], vars[1] = m.sys.Coordinates(cx, cy, cwidth, cheight)
+}
+
+// Returns the derivatives of the coordinates of the pixel (x, y) with respect
+// to the pixel's x and y.
+func (m pixelMap) jacobian(x int, y int, width int, height int) (v0x float64, v0y float64, v1x float64, v1y float64) {
+	cx, cy, cwidth, cheight := float64(x), float64(y), width, height
+	if m.viewport != nil {
+		cx, cy, cwidth, cheight = m.viewport.transform(cx, cy, width, height)
+	}
+	if d, ok := m.sys.(DifferentiableCoordinateSystem); ok {
+		v0x, v0y, v1x, v1y = d.Jacobian(cx, cy, cwidth, cheight)
+	} else {
+		v0x, v0y, v1x, v1y = numericJacobian(m.sys, cx, cy, cwidth, cheight)
+	}
+	if m.viewport == nil {
+		return v0x, v0y, v1x, v1y
+	}
+	// The chain rule
+	a, b, c, d := m.viewport.matrix(width, height)
+	return v0x*a + v0y*c, v0x*b + v0y*d, v1x*a + v1y*c, v1x*b + v1y*d
+}
+
+// Returns intervals containing the coordinates of every pixel, for any size of
+// image.
+func (m pixelMap) domain() []autoutils.Interval {
+	if m.viewport == nil || m.viewport.onCanvas() {
+		return m.sys.Domain()
+	}
+	return m.viewport.sampledDomain(m.sys)
+}
+
+// Returns whether parts of functions which only depend on the first variable
+// are the same for every pixel in a column, and ones which only depend on the
+// second the same for every pixel in a row.
+func (m pixelMap) separable() bool {
+	c, ok := m.sys.(*builtinCoordinates)
+	if !ok || !c.separable {
+		return false
+	}
+	if m.viewport == nil {
+		return true
+	}
+	sin, _ := m.viewport.sincos()
+	return sin == 0
+}
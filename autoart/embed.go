@@ -0,0 +1,120 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+// Manifests embedded in PNG, WAV, and MP4 files
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// The keyword of the PNG text chunk which holds the manifest
+const pngKeyword = "autoart"
+
+// Returns m as JSON on one line.
+func (m *Manifest) compactJSON() (string, error) {
+	data, err := json.Marshal(m)
+	return string(data), err
+}
+
+// Encodes img as a PNG, with m embedded in it.
+func EncodePNG(w io.Writer, img image.Image, m *Manifest) error {
+	metadata, err := m.compactJSON()
+	if err != nil {
+		return err
+	}
+	return autoutils.EncodePNGText(w, img, pngKeyword, metadata)
+}
+
+func decodeManifest(metadata string) (*Manifest, error) {
+	return ReadManifest(strings.NewReader(metadata))
+}
+
+// Reads the manifest embedded in a PNG file.
+func ReadPNGManifest(r io.Reader) (*Manifest, error) {
+	metadata, err := autoutils.ReadPNGText(r, pngKeyword)
+	if err != nil {
+		return nil, err
+	}
+	return decodeManifest(metadata)
+}
+
+// Reads the manifest embedded in a WAV file.
+func ReadAudioManifest(r io.Reader) (*Manifest, error) {
+	info, err := autoutils.ReadAudioInfo(r)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range info {
+		if entry.ID == "ICMT" {
+			return decodeManifest(entry.Text)
+		}
+	}
+	return nil, fmt.Errorf("no comment in WAV file")
+}
+
+// Reads the manifest embedded in a video, using ffprobe.
+func ReadVideoManifest(filename string) (*Manifest, error) {
+	cmd := exec.Command("ffprobe", "-v", "error", "-show_entries", "format_tags=comment",
+		"-of", "default=noprint_wrappers=1:nokey=1", filename)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe failed: %v", err)
+	}
+	metadata := strings.TrimSpace(string(output))
+	if metadata == "" {
+		return nil, fmt.Errorf("no comment in video")
+	}
+	return decodeManifest(metadata)
+}
+
+// Reads the manifest embedded in an image, video, or audio file made by
+// AutoArt.
+func ExtractManifest(filename string) (*Manifest, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	magic, _ := reader.Peek(12)
+	var m *Manifest
+	switch {
+	case bytes.HasPrefix(magic, []byte("\x89PNG")):
+		m, err = ReadPNGManifest(reader)
+	case bytes.HasPrefix(magic, []byte("RIFF")):
+		m, err = ReadAudioManifest(reader)
+	default:
+		m, err = ReadVideoManifest(filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return m, nil
+}
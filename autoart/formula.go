@@ -0,0 +1,114 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+// Formulas for captions, like r(x, y) = x + y
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"strings"
+)
+
+// Names of the functions of each color space. The alpha function (if there is
+// one) is called a.
+var channelNames = [][]string{
+	RGB:       {"r", "g", "b"},
+	GRAYSCALE: {"gray"},
+	CMYK:      {"c", "m", "y", "k"},
+	HSV:       {"h", "s", "v"},
+	YCbCr:     {"Y", "Cb", "Cr"},
+	HSL:       {"h", "s", "l"},
+	CIELAB:    {"L", "a", "b"},
+	OKLab:     {"L", "a", "b"},
+	OKLCh:     {"L", "C", "h"},
+}
+
+var channelLaTeX = [][]string{
+	RGB:       {"r", "g", "b"},
+	GRAYSCALE: {`\mathrm{gray}`},
+	CMYK:      {"c", "m", "y", "k"},
+	HSV:       {"h", "s", "v"},
+	YCbCr:     {"Y", "C_b", "C_r"},
+	HSL:       {"h", "s", "l"},
+	CIELAB:    {"L^*", "a^*", "b^*"},
+	OKLab:     {"L", "a", "b"},
+	OKLCh:     {"L", "C", "h"},
+}
+
+// Returns "name(vars) = f", with f in infix notation, or LaTeX if latex is
+// true. f is simplified first.
+func formula(name string, f autoutils.Function, vars []string, latex bool, digits int) string {
+	f.Simplify() // f is a copy, so this doesn't change the caller's function
+	if f.NVars() < len(vars) {
+		vars = vars[:f.NVars()]
+	}
+	var body string
+	if latex {
+		body = f.LaTeX(vars, digits)
+	} else {
+		body = f.Infix(vars, digits)
+	}
+	return fmt.Sprintf("%s(%s) = %s", name, strings.Join(vars, ", "), body)
+}
+
+/*
+Returns the functions of g as formulas, like r(x, y) = x + y, named after the
+color channels they make (or f1, f2, etc. with a palette, where the color of a
+pixel is the color of the first function which is negative there). If latex
+is true, they are written in LaTeX. Constants are rounded to digits significant
+digits, or written exactly if digits is -1.
+*/
+func (g *Genome) Formulas(latex bool, digits int) []string {
+	cs := g.pixelMap().sys
+	vars, channels := append(cs.VarNames()[:2:2], "t"), channelNames[g.Config.ColorSpace]
+	if latex {
+		vars, channels = append(cs.VarLaTeX()[:2:2], "t"), channelLaTeX[g.Config.ColorSpace]
+	}
+	formulas := make([]string, len(g.Functions))
+	for i, f := range g.Functions {
+		var name string
+		switch {
+		case g.Paletted && latex:
+			name = fmt.Sprintf("f_{%d}", i+1)
+		case g.Paletted:
+			name = fmt.Sprintf("f%d", i+1)
+		case i < len(channels):
+			name = channels[i]
+		default:
+			name = "a"
+		}
+		formulas[i] = formula(name, f, vars, latex, digits)
+	}
+	return formulas
+}
+
+// Like Genome.Formulas, but also works for audio manifests, whose function is
+// written as f(t).
+func (m *Manifest) Formulas(latex bool, digits int) ([]string, error) {
+	if m.Kind == KindAudio {
+		return []string{formula("f", m.Functions[0], []string{"t"}, latex, digits)}, nil
+	}
+	g, err := m.Genome()
+	if err != nil {
+		return nil, err
+	}
+	return g.Formulas(latex, digits), nil
+}
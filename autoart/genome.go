@@ -0,0 +1,140 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"image/color"
+	"math/rand"
+)
+
+/*
+A Genome is everything needed to render a piece of art: the functions, and the
+palette if a palette is used. The functions take two variables (x and y) or
+three (x, y, and t). A genome with three variables can be rendered as an image
+(at any time) or as a video.
+*/
+type Genome struct {
+	Paletted      bool
+	Config        Config
+	PaletteConfig PaletteConfig
+	Palette       []color.RGBA
+	Functions     []autoutils.Function
+}
+
+// Returns a random genome whose functions take nvars variables. Use 2 for
+// images (x and y) and 3 for videos (x, y, and t).
+func RandomGenome(nvars int, paletted bool, config Config, pconfig PaletteConfig, rng *rand.Rand) *Genome {
+	g := &Genome{Paletted: paletted, Config: config, PaletteConfig: pconfig}
+	if paletted {
+		g.Palette, g.Functions = randomPaletteFunctions(nvars, pconfig, rng)
+	} else {
+		g.Functions = randomFunctions(nvars, config, rng)
+	}
+	return g
+}
+
+// Renders g at the given time.
+func (g *Genome) Image(width int, height int, time float64) image.Image {
+	vars := []float64{0, 0, time}
+	if g.Paletted {
+		return GenerateImagePaletteFrom(width, height, g.PaletteConfig, g.Functions, vars, g.Palette)
+	}
+	return GenerateImageFromFunctions(width, height, g.Config, g.Functions, vars)
+}
+
+// Renders the frames of g as a video would, without making a video, and calls
+// frame with each one in order.
+func (g *Genome) Frames(width int, height int, time float64, framerate int,
+	frame func(n int64, img image.Image)) {
+	h := newHoister(g.Functions, g.pixelMap(), width, height, true, g.hoisting())
+	if !g.Paletted {
+		h.setVideoRanges(time, g.Config.rectifiers(len(g.Functions)))
+	}
+	frames := int64(time * float64(framerate))
+	for n := int64(0); n < frames; n++ {
+		f := h.frame([]float64{0, 0, float64(n) / float64(framerate)})
+		if g.Paletted {
+			frame(n, renderImagePalette(width, height, g.PaletteConfig, f, g.Palette))
+		} else {
+			frame(n, renderImage(width, height, g.Config, f))
+		}
+	}
+}
+
+// Renders g as a video, using ffmpeg. If m isn't nil, it is embedded in the
+// video's metadata.
+func (g *Genome) Video(width int, height int, time float64, framerate int,
+	filename string, verbose bool, m *Manifest) error {
+	var metadata string
+	if m != nil {
+		var err error
+		if metadata, err = m.compactJSON(); err != nil {
+			return err
+		}
+	}
+	return renderVideo(width, height, g.Paletted, g.Config, g.PaletteConfig,
+		g.Palette, g.Functions, time, framerate, filename, verbose, metadata)
+}
+
+// Makes g a child of g1 and g2. Each function is bred with the matching
+// function of the other parent, and each color of the palette comes from one
+// of the parents. g1 and g2 should have the same configuration.
+func (g *Genome) Breed(g1 *Genome, g2 *Genome, rng *rand.Rand) {
+	grammar := g1.Config.Grammar
+	if g1.Paletted {
+		grammar = g1.PaletteConfig.Grammar
+	}
+	functions := make([]autoutils.Function, len(g1.Functions))
+	for i := range functions {
+		functions[i].BreedWith(grammar, &g1.Functions[i], &g2.Functions[i], rng)
+	}
+	var palette []color.RGBA
+	if g1.Paletted {
+		palette = make([]color.RGBA, len(g1.Palette))
+		for i := range palette {
+			if rng.Intn(2) == 0 {
+				palette[i] = g1.Palette[i]
+			} else {
+				palette[i] = g2.Palette[i]
+			}
+		}
+	}
+	g.Paletted, g.Config, g.PaletteConfig = g1.Paletted, g1.Config, g1.PaletteConfig
+	g.Functions, g.Palette = functions, palette
+}
+
+// Mutates each function of g with probability 1/2, and occasionally replaces
+// one of the colors of the palette.
+func (g *Genome) Mutate(rng *rand.Rand) {
+	grammar := g.Config.Grammar
+	if g.Paletted {
+		grammar = g.PaletteConfig.Grammar
+	}
+	for i := range g.Functions {
+		if rng.Intn(2) == 0 {
+			g.Functions[i].MutateWith(grammar, rng)
+		}
+	}
+	if len(g.Palette) > 0 && rng.Intn(4) == 0 {
+		g.Palette[rng.Intn(len(g.Palette))] = randomPalette(rng, 1, g.PaletteConfig.Alpha)[0]
+	}
+}
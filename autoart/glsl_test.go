@@ -0,0 +1,892 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+A small interpreter for the part of GLSL ES 3.00 which WriteShader writes, so
+shaders can be checked against the CPU renderer without a GPU. Floats are 64
+bits, so the only differences from the CPU come from the shader itself (and
+its constants, which are written as 32-bit floats).
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	glslFloat = iota
+	glslInt
+	glslUint
+	glslBool
+	glslVec
+	glslVoid
+)
+
+type glslValue struct {
+	kind int
+	n    float64    // The value of a scalar (1 or 0 for bools)
+	v    [4]float64 // The components of a vector
+	size int        // How many components a vector has
+	arr  []float64  // The elements of an array, which are scalars of kind
+}
+
+type glslFrame struct {
+	locals []glslValue
+	ret    glslValue
+}
+
+const (
+	glslNext = iota
+	glslBreak
+	glslReturn
+)
+
+type glslExpr func(f *glslFrame) glslValue
+type glslStmt func(f *glslFrame) int
+
+type glslFunction struct {
+	params  []glslVariable
+	nlocals int
+	body    glslStmt
+}
+
+type glslVariable struct {
+	slot   int
+	global bool
+	kind   int
+	size   int
+}
+
+type glslProgram struct {
+	globals     []glslValue
+	globalNames map[string]glslVariable
+	functions   map[string]*glslFunction
+}
+
+type glslParser struct {
+	tokens  []string
+	pos     int
+	prog    *glslProgram
+	scopes  []map[string]glslVariable
+	nlocals int
+}
+
+func glslScalar(kind int, n float64) glslValue {
+	switch kind {
+	case glslInt:
+		n = float64(int32(int64(n)))
+	case glslUint:
+		n = float64(uint32(int64(n)))
+	}
+	return glslValue{kind: kind, n: n}
+}
+
+func glslBoolValue(b bool) glslValue {
+	if b {
+		return glslValue{kind: glslBool, n: 1}
+	}
+	return glslValue{kind: glslBool}
+}
+
+// Converts a scalar to kind, like GLSL's constructors.
+func (x glslValue) to(kind int) glslValue {
+	if x.kind == kind || kind == glslVec || x.kind == glslVec {
+		return x
+	}
+	if kind == glslInt || kind == glslUint {
+		if math.IsNaN(x.n) || math.IsInf(x.n, 0) {
+			return glslValue{kind: kind}
+		}
+		return glslScalar(kind, math.Trunc(x.n))
+	}
+	if kind == glslBool {
+		return glslBoolValue(x.n != 0)
+	}
+	return glslValue{kind: kind, n: x.n}
+}
+
+func (x glslValue) components() []float64 {
+	if x.kind == glslVec {
+		return x.v[:x.size]
+	}
+	return []float64{x.n}
+}
+
+func glslVector(components []float64) glslValue {
+	v := glslValue{kind: glslVec, size: len(components)}
+	copy(v.v[:], components)
+	return v
+}
+
+func glslTokens(src string) []string {
+	var tokens []string
+	lines := strings.Split(src, "\n")
+	for _, line := range lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "#") {
+			continue
+		}
+		for i := 0; i < len(line); {
+			c := line[i]
+			switch {
+			case c == ' ' || c == '\t' || c == '\r':
+				i++
+			case strings.HasPrefix(line[i:], "//"):
+				i = len(line)
+			case c >= '0' && c <= '9' || c == '.' && i+1 < len(line) && line[i+1] >= '0' && line[i+1] <= '9':
+				j := i
+				if strings.HasPrefix(line[i:], "0x") {
+					j += 2
+					for j < len(line) && strings.IndexByte("0123456789abcdefABCDEF", line[j]) >= 0 {
+						j++
+					}
+				} else {
+					for j < len(line) && (line[j] >= '0' && line[j] <= '9' || line[j] == '.') {
+						j++
+					}
+					if j < len(line) && (line[j] == 'e' || line[j] == 'E') {
+						j++
+						if line[j] == '-' || line[j] == '+' {
+							j++
+						}
+						for j < len(line) && line[j] >= '0' && line[j] <= '9' {
+							j++
+						}
+					}
+				}
+				if j < len(line) && line[j] == 'u' {
+					j++
+				}
+				tokens = append(tokens, line[i:j])
+				i = j
+			case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+				j := i
+				for j < len(line) && (line[j] == '_' || line[j] >= 'a' && line[j] <= 'z' ||
+					line[j] >= 'A' && line[j] <= 'Z' || line[j] >= '0' && line[j] <= '9') {
+					j++
+				}
+				tokens = append(tokens, line[i:j])
+				i = j
+			default:
+				n := 1
+				if i+1 < len(line) {
+					switch line[i : i+2] {
+					case "<=", ">=", "==", "!=", "&&", "||", "+=", "-=", "*=", "/=", "&=", "|=", "++", "--", "<<", ">>":
+						n = 2
+					}
+				}
+				tokens = append(tokens, line[i:i+n])
+				i += n
+			}
+		}
+	}
+	return tokens
+}
+
+// Returns the kind and size of a type, and whether it is one.
+func glslType(name string) (int, int, bool) {
+	switch name {
+	case "float":
+		return glslFloat, 0, true
+	case "int":
+		return glslInt, 0, true
+	case "uint":
+		return glslUint, 0, true
+	case "bool":
+		return glslBool, 0, true
+	case "vec2", "vec3", "vec4":
+		return glslVec, int(name[3] - '0'), true
+	case "void":
+		return glslVoid, 0, true
+	}
+	return 0, 0, false
+}
+
+// Compiles a shader. It panics if the shader isn't in the part of GLSL the
+// interpreter knows.
+func compileGLSL(src string) *glslProgram {
+	p := &glslParser{tokens: glslTokens(src), prog: &glslProgram{
+		globalNames: make(map[string]glslVariable),
+		functions:   make(map[string]*glslFunction),
+	}}
+	p.declareGlobal("gl_FragCoord", glslVec, 4)
+	for p.pos < len(p.tokens) {
+		p.topLevel()
+	}
+	return p.prog
+}
+
+func (p *glslParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *glslParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *glslParser) accept(token string) bool {
+	if p.peek() == token {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *glslParser) expect(token string) {
+	if t := p.next(); t != token {
+		panic(fmt.Sprintf("expected %q, got %q (token %d)", token, t, p.pos-1))
+	}
+}
+
+func (p *glslParser) declareGlobal(name string, kind int, size int) glslVariable {
+	v := glslVariable{slot: len(p.prog.globals), global: true, kind: kind, size: size}
+	p.prog.globals = append(p.prog.globals, glslValue{kind: kind, size: size})
+	p.prog.globalNames[name] = v
+	return v
+}
+
+func (p *glslParser) declareLocal(name string, kind int, size int) glslVariable {
+	v := glslVariable{slot: p.nlocals, kind: kind, size: size}
+	p.nlocals++
+	p.scopes[len(p.scopes)-1][name] = v
+	return v
+}
+
+func (p *glslParser) lookup(name string) glslVariable {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if v, ok := p.scopes[i][name]; ok {
+			return v
+		}
+	}
+	v, ok := p.prog.globalNames[name]
+	if !ok {
+		panic(fmt.Sprintf("unknown variable %q", name))
+	}
+	return v
+}
+
+func (p *glslParser) topLevel() {
+	if p.accept("precision") {
+		for p.next() != ";" {
+		}
+		return
+	}
+	for p.accept("uniform") || p.accept("out") || p.accept("const") {
+	}
+	kind, size, ok := glslType(p.next())
+	if !ok {
+		panic(fmt.Sprintf("expected a type, got %q", p.tokens[p.pos-1]))
+	}
+	name := p.next()
+	if !p.accept("(") {
+		// A global variable
+		p.pos--
+		for {
+			name := p.next()
+			if p.accept("[") {
+				p.next()
+				p.expect("]")
+			}
+			var value glslValue
+			if p.accept("=") {
+				value = p.expression()(nil).to(kind)
+			}
+			v := p.declareGlobal(name, kind, size)
+			if value.kind == kind {
+				p.prog.globals[v.slot] = value
+			}
+			if !p.accept(",") {
+				break
+			}
+		}
+		p.expect(";")
+		return
+	}
+	fn := new(glslFunction)
+	p.scopes = []map[string]glslVariable{make(map[string]glslVariable)}
+	p.nlocals = 0
+	for !p.accept(")") {
+		for p.accept("in") || p.accept("out") || p.accept("inout") {
+		}
+		kind, size, _ := glslType(p.next())
+		fn.params = append(fn.params, p.declareLocal(p.next(), kind, size))
+		p.accept(",")
+	}
+	p.prog.functions[name] = fn
+	fn.body = p.statement()
+	fn.nlocals = p.nlocals
+	p.scopes = nil
+}
+
+func (p *glslParser) block(end string) []glslStmt {
+	var stmts []glslStmt
+	for p.peek() != end && p.peek() != "case" && p.peek() != "default" {
+		stmts = append(stmts, p.statement())
+	}
+	return stmts
+}
+
+func glslRun(stmts []glslStmt, f *glslFrame) int {
+	for _, s := range stmts {
+		if c := s(f); c != glslNext {
+			return c
+		}
+	}
+	return glslNext
+}
+
+func (p *glslParser) statement() glslStmt {
+	switch p.peek() {
+	case "{":
+		p.next()
+		p.scopes = append(p.scopes, make(map[string]glslVariable))
+		stmts := p.block("}")
+		p.expect("}")
+		p.scopes = p.scopes[:len(p.scopes)-1]
+		return func(f *glslFrame) int {
+			return glslRun(stmts, f)
+		}
+	case "if":
+		p.next()
+		p.expect("(")
+		cond := p.expression()
+		p.expect(")")
+		then := p.statement()
+		otherwise := func(f *glslFrame) int { return glslNext }
+		if p.accept("else") {
+			otherwise = p.statement()
+		}
+		return func(f *glslFrame) int {
+			if cond(f).n != 0 {
+				return then(f)
+			}
+			return otherwise(f)
+		}
+	case "for":
+		p.next()
+		p.expect("(")
+		p.scopes = append(p.scopes, make(map[string]glslVariable))
+		init := p.simpleStatement()
+		p.expect(";")
+		cond := p.expression()
+		p.expect(";")
+		step := p.simpleStatement()
+		p.expect(")")
+		body := p.statement()
+		p.scopes = p.scopes[:len(p.scopes)-1]
+		return func(f *glslFrame) int {
+			for init(f); cond(f).n != 0; step(f) {
+				switch body(f) {
+				case glslBreak:
+					return glslNext
+				case glslReturn:
+					return glslReturn
+				}
+			}
+			return glslNext
+		}
+	case "switch":
+		p.next()
+		p.expect("(")
+		value := p.expression()
+		p.expect(")")
+		p.expect("{")
+		var stmts []glslStmt
+		labels := make(map[float64]int)
+		defaultLabel := -1
+		for !p.accept("}") {
+			if p.accept("default") {
+				defaultLabel = len(stmts)
+			} else {
+				p.expect("case")
+				labels[p.expression()(nil).n] = len(stmts)
+			}
+			p.expect(":")
+			stmts = append(stmts, p.block("}")...)
+		}
+		return func(f *glslFrame) int {
+			start, ok := labels[value(f).n]
+			if !ok {
+				if defaultLabel < 0 {
+					return glslNext
+				}
+				start = defaultLabel
+			}
+			if c := glslRun(stmts[start:], f); c == glslReturn {
+				return c
+			}
+			return glslNext
+		}
+	case "return":
+		p.next()
+		if p.accept(";") {
+			return func(f *glslFrame) int { return glslReturn }
+		}
+		value := p.expression()
+		p.expect(";")
+		return func(f *glslFrame) int {
+			f.ret = value(f)
+			return glslReturn
+		}
+	case "break":
+		p.next()
+		p.expect(";")
+		return func(f *glslFrame) int { return glslBreak }
+	}
+	s := p.simpleStatement()
+	p.expect(";")
+	return s
+}
+
+// Parses a declaration, assignment, or expression, without the semicolon.
+func (p *glslParser) simpleStatement() glslStmt {
+	p.accept("const")
+	if kind, size, ok := glslType(p.peek()); ok {
+		p.next()
+		var stmts []glslStmt
+		for {
+			name := p.next()
+			init := func(f *glslFrame) glslValue { return glslValue{kind: kind, size: size} }
+			if p.accept("=") {
+				value := p.expression()
+				init = func(f *glslFrame) glslValue { return value(f).to(kind) }
+			}
+			v := p.declareLocal(name, kind, size)
+			stmts = append(stmts, func(f *glslFrame) int {
+				f.locals[v.slot] = init(f)
+				return glslNext
+			})
+			if !p.accept(",") {
+				break
+			}
+		}
+		return func(f *glslFrame) int { return glslRun(stmts, f) }
+	}
+	if p.pos+1 < len(p.tokens) {
+		op := p.tokens[p.pos+1]
+		switch op {
+		case "=", "+=", "-=", "*=", "/=", "&=", "|=", "++", "--":
+			v := p.lookup(p.next())
+			p.next()
+			var value glslExpr
+			switch op {
+			case "++", "--":
+				value = func(f *glslFrame) glslValue { return glslValue{kind: v.kind, n: 1} }
+				op = op[:1] + "="
+			default:
+				value = p.expression()
+			}
+			get := p.variable(v)
+			set := func(f *glslFrame, x glslValue) {
+				x = x.to(v.kind)
+				if v.global {
+					p.prog.globals[v.slot] = x
+				} else {
+					f.locals[v.slot] = x
+				}
+			}
+			if op == "=" {
+				return func(f *glslFrame) int {
+					set(f, value(f))
+					return glslNext
+				}
+			}
+			binary := op[:1]
+			return func(f *glslFrame) int {
+				set(f, glslBinary(binary, get(f), value(f)))
+				return glslNext
+			}
+		}
+	}
+	e := p.expression()
+	return func(f *glslFrame) int {
+		e(f)
+		return glslNext
+	}
+}
+
+func (p *glslParser) variable(v glslVariable) glslExpr {
+	if v.global {
+		prog := p.prog
+		return func(f *glslFrame) glslValue { return prog.globals[v.slot] }
+	}
+	return func(f *glslFrame) glslValue { return f.locals[v.slot] }
+}
+
+var glslPrecedence = map[string]int{
+	"||": 1, "&&": 2, "|": 3, "&": 4, "==": 5, "!=": 5,
+	"<": 6, ">": 6, "<=": 6, ">=": 6, "<<": 7, ">>": 7,
+	"+": 8, "-": 8, "*": 9, "/": 9, "%": 9,
+}
+
+func (p *glslParser) expression() glslExpr {
+	cond := p.binary(1)
+	if !p.accept("?") {
+		return cond
+	}
+	a := p.expression()
+	p.expect(":")
+	b := p.expression()
+	return func(f *glslFrame) glslValue {
+		if cond(f).n != 0 {
+			return a(f)
+		}
+		return b(f)
+	}
+}
+
+func (p *glslParser) binary(minPrecedence int) glslExpr {
+	left := p.unary()
+	for {
+		op := p.peek()
+		precedence, ok := glslPrecedence[op]
+		if !ok || precedence < minPrecedence {
+			return left
+		}
+		p.next()
+		a, b := left, p.binary(precedence+1)
+		switch op {
+		case "&&":
+			left = func(f *glslFrame) glslValue { return glslBoolValue(a(f).n != 0 && b(f).n != 0) }
+		case "||":
+			left = func(f *glslFrame) glslValue { return glslBoolValue(a(f).n != 0 || b(f).n != 0) }
+		default:
+			left = func(f *glslFrame) glslValue { return glslBinary(op, a(f), b(f)) }
+		}
+	}
+}
+
+func (p *glslParser) unary() glslExpr {
+	switch {
+	case p.accept("-"):
+		x := p.unary()
+		return func(f *glslFrame) glslValue {
+			v := x(f)
+			if v.kind == glslVec {
+				for i := range v.v {
+					v.v[i] = -v.v[i]
+				}
+				return v
+			}
+			return glslScalar(v.kind, -v.n)
+		}
+	case p.accept("+"):
+		return p.unary()
+	case p.accept("!"):
+		x := p.unary()
+		return func(f *glslFrame) glslValue { return glslBoolValue(x(f).n == 0) }
+	}
+	return p.postfix(p.primary())
+}
+
+func (p *glslParser) postfix(x glslExpr) glslExpr {
+	for {
+		switch {
+		case p.accept("."):
+			var indices []int
+			for _, c := range p.next() {
+				indices = append(indices, strings.IndexRune("xyzw", c))
+			}
+			a := x
+			x = func(f *glslFrame) glslValue {
+				v := a(f)
+				if len(indices) == 1 {
+					return glslValue{kind: glslFloat, n: v.v[indices[0]]}
+				}
+				components := make([]float64, len(indices))
+				for i, j := range indices {
+					components[i] = v.v[j]
+				}
+				return glslVector(components)
+			}
+		case p.accept("["):
+			index := p.expression()
+			p.expect("]")
+			a := x
+			x = func(f *glslFrame) glslValue {
+				v := a(f)
+				return glslValue{kind: v.kind, n: v.arr[int(index(f).n)]}
+			}
+		default:
+			return x
+		}
+	}
+}
+
+func (p *glslParser) arguments() []glslExpr {
+	p.expect("(")
+	var args []glslExpr
+	for !p.accept(")") {
+		args = append(args, p.expression())
+		p.accept(",")
+	}
+	return args
+}
+
+func glslEvaluate(args []glslExpr, f *glslFrame) []glslValue {
+	values := make([]glslValue, len(args))
+	for i, arg := range args {
+		values[i] = arg(f)
+	}
+	return values
+}
+
+func (p *glslParser) primary() glslExpr {
+	token := p.next()
+	switch {
+	case token == "(":
+		x := p.expression()
+		p.expect(")")
+		return x
+	case token == "true" || token == "false":
+		v := glslBoolValue(token == "true")
+		return func(f *glslFrame) glslValue { return v }
+	case token[0] >= '0' && token[0] <= '9' || token[0] == '.':
+		v := glslLiteral(token)
+		return func(f *glslFrame) glslValue { return v }
+	}
+	if kind, size, ok := glslType(token); ok {
+		if p.accept("[") {
+			// An array
+			p.next()
+			p.expect("]")
+			args := p.arguments()
+			return func(f *glslFrame) glslValue {
+				v := glslValue{kind: kind, arr: make([]float64, len(args))}
+				for i, arg := range args {
+					v.arr[i] = arg(f).to(kind).n
+				}
+				return v
+			}
+		}
+		args := p.arguments()
+		if kind == glslVec {
+			return func(f *glslFrame) glslValue {
+				var components []float64
+				for _, arg := range glslEvaluate(args, f) {
+					components = append(components, arg.components()...)
+				}
+				for len(components) < size {
+					components = append(components, components[0])
+				}
+				return glslVector(components)
+			}
+		}
+		return func(f *glslFrame) glslValue { return args[0](f).to(kind) }
+	}
+	if p.peek() != "(" {
+		return p.variable(p.lookup(token))
+	}
+	args := p.arguments()
+	if fn, ok := p.prog.functions[token]; ok {
+		return func(f *glslFrame) glslValue { return fn.call(glslEvaluate(args, f)) }
+	}
+	builtin, ok := glslBuiltins[token]
+	if !ok {
+		panic(fmt.Sprintf("unknown function %q", token))
+	}
+	return func(f *glslFrame) glslValue { return builtin(glslEvaluate(args, f)) }
+}
+
+func glslLiteral(token string) glslValue {
+	kind := glslInt
+	if strings.HasSuffix(token, "u") {
+		kind = glslUint
+		token = token[:len(token)-1]
+	}
+	if !strings.HasPrefix(token, "0x") && strings.ContainsAny(token, ".eE") {
+		x, err := strconv.ParseFloat(token, 64)
+		if err != nil {
+			panic(err)
+		}
+		return glslValue{kind: glslFloat, n: x}
+	}
+	x, err := strconv.ParseInt(token, 0, 64)
+	if err != nil {
+		panic(err)
+	}
+	return glslScalar(kind, float64(x))
+}
+
+func (fn *glslFunction) call(args []glslValue) glslValue {
+	ret, _ := fn.callWithParams(args)
+	return ret
+}
+
+// Calls fn, and returns what it returns, and its parameters afterwards (for out
+// parameters).
+func (fn *glslFunction) callWithParams(args []glslValue) (glslValue, []glslValue) {
+	f := &glslFrame{locals: make([]glslValue, fn.nlocals)}
+	for i, param := range fn.params {
+		if i < len(args) {
+			f.locals[param.slot] = args[i].to(param.kind)
+		} else {
+			f.locals[param.slot] = glslValue{kind: param.kind, size: param.size}
+		}
+	}
+	fn.body(f)
+	return f.ret, f.locals[:len(fn.params)]
+}
+
+func glslBinary(op string, a glslValue, b glslValue) glslValue {
+	if a.kind == glslVec || b.kind == glslVec {
+		size := a.size
+		if b.size > size {
+			size = b.size
+		}
+		components := make([]float64, size)
+		for i := range components {
+			x, y := a.n, b.n
+			if a.kind == glslVec {
+				x = a.v[i]
+			}
+			if b.kind == glslVec {
+				y = b.v[i]
+			}
+			components[i] = glslBinary(op, glslValue{n: x}, glslValue{n: y}).n
+		}
+		return glslVector(components)
+	}
+	x, y := a.n, b.n
+	switch op {
+	case "==":
+		return glslBoolValue(x == y)
+	case "!=":
+		return glslBoolValue(x != y)
+	case "<":
+		return glslBoolValue(x < y)
+	case ">":
+		return glslBoolValue(x > y)
+	case "<=":
+		return glslBoolValue(x <= y)
+	case ">=":
+		return glslBoolValue(x >= y)
+	}
+	if a.kind == glslFloat {
+		switch op {
+		case "+":
+			return glslValue{n: x + y}
+		case "-":
+			return glslValue{n: x - y}
+		case "*":
+			return glslValue{n: x * y}
+		case "/":
+			return glslValue{n: x / y}
+		}
+		panic(fmt.Sprintf("can't use %s on floats", op))
+	}
+	i, j := int64(x), int64(y)
+	var n int64
+	switch op {
+	case "+":
+		n = i + j
+	case "-":
+		n = i - j
+	case "*":
+		n = i * j
+	case "/":
+		if j != 0 {
+			n = i / j
+		}
+	case "%":
+		if j != 0 {
+			n = i % j
+		}
+	case "&":
+		n = i & j
+	case "|":
+		n = i | j
+	case "<<":
+		n = i << uint(j)
+	case ">>":
+		n = i >> uint(j)
+	default:
+		panic(fmt.Sprintf("can't use %s on integers", op))
+	}
+	return glslScalar(a.kind, float64(n))
+}
+
+func glslFloat1(f func(float64) float64) func([]glslValue) glslValue {
+	return func(args []glslValue) glslValue { return glslValue{n: f(args[0].n)} }
+}
+
+func glslFloat2(f func(float64, float64) float64) func([]glslValue) glslValue {
+	return func(args []glslValue) glslValue { return glslValue{n: f(args[0].n, args[1].n)} }
+}
+
+func glslMin(x float64, y float64) float64 {
+	if y < x {
+		return y
+	}
+	return x
+}
+
+func glslMax(x float64, y float64) float64 {
+	if x < y {
+		return y
+	}
+	return x
+}
+
+var glslBuiltins = map[string]func([]glslValue) glslValue{
+	"sin":   glslFloat1(math.Sin),
+	"cos":   glslFloat1(math.Cos),
+	"tan":   glslFloat1(math.Tan),
+	"asin":  glslFloat1(math.Asin),
+	"acos":  glslFloat1(math.Acos),
+	"acosh": glslFloat1(math.Acosh),
+	"tanh":  glslFloat1(math.Tanh),
+	"exp":   glslFloat1(math.Exp),
+	"log":   glslFloat1(math.Log),
+	"sqrt":  glslFloat1(math.Sqrt),
+	"abs":   glslFloat1(math.Abs),
+	"floor": glslFloat1(math.Floor),
+	"trunc": glslFloat1(math.Trunc),
+	"fract": glslFloat1(func(x float64) float64 { return x - math.Floor(x) }),
+	"pow":   glslFloat2(math.Pow),
+	"mod":   glslFloat2(func(x float64, y float64) float64 { return x - y*math.Floor(x/y) }),
+	"atan": func(args []glslValue) glslValue {
+		if len(args) == 1 {
+			return glslValue{n: math.Atan(args[0].n)}
+		}
+		return glslValue{n: math.Atan2(args[0].n, args[1].n)}
+	},
+	"min": func(args []glslValue) glslValue {
+		return glslValue{kind: args[0].kind, n: glslMin(args[0].n, args[1].n)}
+	},
+	"max": func(args []glslValue) glslValue {
+		return glslValue{kind: args[0].kind, n: glslMax(args[0].n, args[1].n)}
+	},
+	"clamp": func(args []glslValue) glslValue {
+		return glslValue{kind: args[0].kind, n: glslMin(glslMax(args[0].n, args[1].n), args[2].n)}
+	},
+	"isnan": func(args []glslValue) glslValue { return glslBoolValue(math.IsNaN(args[0].n)) },
+	"isinf": func(args []glslValue) glslValue { return glslBoolValue(math.IsInf(args[0].n, 0)) },
+	"uintBitsToFloat": func(args []glslValue) glslValue {
+		return glslValue{n: float64(math.Float32frombits(uint32(args[0].n)))}
+	},
+}
@@ -0,0 +1,354 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Hoisting
+
+Every function is evaluated at every pixel (of every frame), but parts of it
+often don't change from one pixel to the next. With XY (or CENTERED)
+coordinates, parts which only depend on x are the same for every pixel in a
+column, and parts which only depend on y are the same for every pixel in a row
+(unless the viewport is turned). In videos, parts which don't depend on t are
+the same in every frame. These parts are split off (see
+autoutils.Function.Split), evaluated once per column, row, or frame, and
+cached, so the main function just reads their values. The output is exactly the
+same as evaluating the whole function at every pixel.
+*/
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"time"
+)
+
+// The most memory the per-pixel caches of a video can use
+const maxPixelCacheBytes = 1 << 28
+
+// What a part's cached values are indexed by
+const (
+	partConstant = iota // One value
+	partColumn          // One value per column
+	partRow             // One value per row
+	partPixel           // One value per pixel
+)
+
+type hoistedPart struct {
+	function autoutils.Function
+	kind     int
+	// Whether the part is the same in every frame, so it only needs to be
+	// evaluated once
+	static bool
+}
+
+type hoistedFunction struct {
+	main  autoutils.Function
+	parts []hoistedPart
+}
+
+// Functions prepared for rendering at a given size
+type hoister struct {
+	width  int
+	height int
+	pixels pixelMap
+	// The functions before hoisting
+	source    []autoutils.Function
+	functions []hoistedFunction
+	// The ranges of the functions for their rectifiers over every frame of a
+	// video, or nil if they should be worked out for each frame
+	ranges []autoutils.Interval
+	// static[i][j] holds the values of part j of function i, if it is static.
+	static [][][]float64
+}
+
+// One frame (or image) rendered by a hoister
+type hoistedFrame struct {
+	h    *hoister
+	vars []float64
+	// values[i][j] holds the values of part j of function i.
+	values [][][]float64
+}
+
+// Variables 0 and 1 are the coordinates. Any others (i.e. t) are the same for
+// every pixel in a frame.
+const (
+	varX      autoutils.VarSet = 1
+	varY      autoutils.VarSet = 2
+	varsFrame                  = ^(varX | varY)
+)
+
+// How the parts split off by each set are cached, in the order they should be
+// tried (cheapest first)
+type cacheSet struct {
+	vars   autoutils.VarSet
+	kind   int
+	static bool
+}
+
+// Returns the cache sets for the given coordinate system. If video is true, the
+// functions will be rendered at more than one time, so parts which don't depend
+// on time are cached across frames. If pixels is false, parts aren't cached
+// per pixel.
+func cacheSets(m pixelMap, video bool, pixels bool) []cacheSet {
+	var sets []cacheSet
+	if video {
+		if m.separable() {
+			sets = append(sets, cacheSet{varX, partColumn, true}, cacheSet{varY, partRow, true})
+		}
+		if pixels {
+			sets = append(sets, cacheSet{varX | varY, partPixel, true})
+		}
+	}
+	sets = append(sets, cacheSet{varsFrame, partConstant, false})
+	if m.separable() {
+		sets = append(sets, cacheSet{varX | varsFrame, partColumn, false}, cacheSet{varY | varsFrame, partRow, false})
+	}
+	return sets
+}
+
+func hoistFunctions(functions []autoutils.Function, sets []cacheSet) []hoistedFunction {
+	varSets := make([]autoutils.VarSet, len(sets))
+	for i, set := range sets {
+		varSets[i] = set.vars
+	}
+	hoisted := make([]hoistedFunction, len(functions))
+	for i := range functions {
+		split := functions[i].Split(varSets)
+		hoisted[i].main = split.Main
+		for j, part := range split.Parts {
+			set := sets[split.Sets[j]]
+			hoisted[i].parts = append(hoisted[i].parts, hoistedPart{part, set.kind, set.static})
+		}
+	}
+	return hoisted
+}
+
+// Returns the number of values a part of the given kind has.
+func (h *hoister) cacheSize(kind int) int {
+	switch kind {
+	case partColumn:
+		return h.width
+	case partRow:
+		return h.height
+	case partPixel:
+		return h.width * h.height
+	}
+	return 1
+}
+
+// Whether parts of g's functions are hoisted out of the inner loop
+func (g *Genome) hoisting() bool {
+	if g.Paletted {
+		return !g.PaletteConfig.noHoisting
+	}
+	return !g.Config.noHoisting
+}
+
+// Returns a hoister for rendering functions at the given size. If video is
+// true, it can be used for more than one frame. If hoist is false, nothing is
+// hoisted out of the inner loop.
+func newHoister(functions []autoutils.Function, m pixelMap, width int, height int, video bool, hoist bool) *hoister {
+	h := &hoister{width: width, height: height, pixels: m, source: functions}
+	var sets []cacheSet
+	if hoist {
+		sets = cacheSets(m, video, true)
+	}
+	h.functions = hoistFunctions(functions, sets)
+	if video {
+		size := 0
+		for _, f := range h.functions {
+			for _, part := range f.parts {
+				if part.kind == partPixel {
+					size += 8 * width * height
+				}
+			}
+		}
+		if size > maxPixelCacheBytes {
+			h.functions = hoistFunctions(functions, cacheSets(m, video, false))
+		}
+	}
+	h.static = make([][][]float64, len(h.functions))
+	for i, f := range h.functions {
+		h.static[i] = make([][]float64, len(f.parts))
+		for j, part := range f.parts {
+			if part.static {
+				h.static[i][j] = h.evaluatePart(&part.function, part.kind, nil)
+			}
+		}
+	}
+	return h
+}
+
+// Returns the values of a part of the given kind. Variables other than the
+// coordinates are taken from vars.
+func (h *hoister) evaluatePart(function *autoutils.Function, kind int, vars []float64) []float64 {
+	values := make([]float64, h.cacheSize(kind))
+	newVars := func() []float64 {
+		v := make([]float64, function.NVars())
+		copy(v, vars)
+		return v
+	}
+	if kind == partPixel {
+		parallelRows(h.height, func() func(y int) {
+			compiled := function.Compile()
+			vars := newVars()
+			return func(y int) {
+				for x := 0; x < h.width; x++ {
+					h.pixels.set(vars, x, y, h.width, h.height)
+					values[y*h.width+x] = compiled.Evaluate(vars)
+				}
+			}
+		})
+		return values
+	}
+	compiled := function.Compile()
+	v := newVars()
+	for i := range values {
+		x, y := 0, 0
+		switch kind {
+		case partColumn:
+			x = i
+		case partRow:
+			y = i
+		}
+		h.pixels.set(v, x, y, h.width, h.height)
+		values[i] = compiled.Evaluate(v)
+	}
+	return values
+}
+
+// Returns a frame with the given variables (other than the coordinates).
+func (h *hoister) frame(vars []float64) *hoistedFrame {
+	fr := &hoistedFrame{h: h, vars: vars}
+	fr.values = make([][][]float64, len(h.functions))
+	for i, f := range h.functions {
+		fr.values[i] = make([][]float64, len(f.parts))
+		for j, part := range f.parts {
+			if part.static {
+				fr.values[i][j] = h.static[i][j]
+			} else {
+				fr.values[i][j] = h.evaluatePart(&part.function, part.kind, vars)
+			}
+		}
+	}
+	return fr
+}
+
+// Returns a function which evaluates function i at the pixel (x, y). The
+// returned function can't be shared between goroutines, so each one should call
+// evaluator itself.
+func (fr *hoistedFrame) evaluator() func(i int, x int, y int) float64 {
+	h := fr.h
+	compiled := make([]*autoutils.CompiledFunction, len(h.functions))
+	vars := make([][]float64, len(h.functions))
+	for i, f := range h.functions {
+		compiled[i] = f.main.Compile()
+		vars[i] = make([]float64, f.main.NVars())
+		nvars := len(vars[i]) - len(f.parts)
+		copy(vars[i][:nvars], fr.vars)
+		for j, part := range f.parts {
+			if part.kind == partConstant {
+				vars[i][nvars+j] = fr.values[i][j][0]
+			}
+		}
+	}
+	return func(i int, x int, y int) float64 {
+		v := vars[i]
+		h.pixels.set(v, x, y, h.width, h.height)
+		parts := h.functions[i].parts
+		nvars := len(v) - len(parts)
+		for j, part := range parts {
+			switch part.kind {
+			case partColumn:
+				v[nvars+j] = fr.values[i][j][x]
+			case partRow:
+				v[nvars+j] = fr.values[i][j][y]
+			case partPixel:
+				v[nvars+j] = fr.values[i][j][y*h.width+x]
+			}
+		}
+		return compiled[i].Evaluate(v)
+	}
+}
+
+// Returns the ranges of the functions in the frame for the given rectifiers
+// (see rectifierRanges).
+func (fr *hoistedFrame) rectifierRanges(rectifiers []int) []autoutils.Interval {
+	if fr.h.ranges != nil {
+		return fr.h.ranges
+	}
+	var time autoutils.Interval
+	if len(fr.vars) > 2 {
+		time = autoutils.Interval{Min: fr.vars[2], Max: fr.vars[2]}
+	}
+	h := fr.h
+	return rectifierRanges(h.source, rectifiers, h.pixels, h.width, h.height, time)
+}
+
+// Makes the ranges of the functions for the given rectifiers be worked out
+// over every frame of a video of the given length, rather than for each frame.
+func (h *hoister) setVideoRanges(length float64, rectifiers []int) {
+	h.ranges = rectifierRanges(h.source, rectifiers, h.pixels, h.width, h.height,
+		autoutils.Interval{Min: 0, Max: length})
+}
+
+// How long rendering took with and without hoisting (see TimeHoisting)
+type HoistingTimes struct {
+	Images        time.Duration
+	HoistedImages time.Duration
+	Video         time.Duration
+	HoistedVideo  time.Duration
+}
+
+// Renders the genomes as images and as frames of video, with and without
+// hoisting, and returns how long each took. Returns an error if hoisting
+// changed the output.
+func TimeHoisting(genomes []*Genome, width int, height int, frames int64) (HoistingTimes, error) {
+	var times HoistingTimes
+	render := func(hoist bool, images *time.Duration, video *time.Duration) (pix [][]uint8) {
+		start := time.Now()
+		for _, g := range genomes {
+			h := *g
+			h.Config.noHoisting, h.PaletteConfig.noHoisting = !hoist, !hoist
+			pix = append(pix, h.Image(width, height, 0).(*image.RGBA).Pix)
+		}
+		*images = time.Since(start)
+		start = time.Now()
+		for _, g := range genomes {
+			h := *g
+			h.Config.noHoisting, h.PaletteConfig.noHoisting = !hoist, !hoist
+			h.Frames(width, height, float64(frames), 1, func(n int64, img image.Image) {
+				pix = append(pix, img.(*image.RGBA).Pix)
+			})
+		}
+		*video = time.Since(start)
+		return pix
+	}
+	pix := render(false, &times.Images, &times.Video)
+	hoistedPix := render(true, &times.HoistedImages, &times.HoistedVideo)
+	for i := range pix {
+		if !bytes.Equal(pix[i], hoistedPix[i]) {
+			return times, fmt.Errorf("hoisting changed the output")
+		}
+	}
+	return times, nil
+}
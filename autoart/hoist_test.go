@@ -0,0 +1,97 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"testing"
+)
+
+// Renders g as an image and as a few video frames, with or without hoisting,
+// and returns the pixels of everything rendered.
+func renderHoisting(g *Genome, width int, height int, frames int, hoist bool) [][]uint8 {
+	h := *g
+	h.Config.noHoisting, h.PaletteConfig.noHoisting = !hoist, !hoist
+	pix := [][]uint8{h.Image(width, height, 0.5).(*image.RGBA).Pix}
+	h.Frames(width, height, float64(frames), 1, func(n int64, img image.Image) {
+		pix = append(pix, img.(*image.RGBA).Pix)
+	})
+	return pix
+}
+
+// Checks that hoisting doesn't change how g is rendered at the given size.
+func checkHoisting(t *testing.T, name string, g *Genome, width int, height int) {
+	t.Helper()
+	without := renderHoisting(g, width, height, 3, false)
+	with := renderHoisting(g, width, height, 3, true)
+	for i := range without {
+		if !bytes.Equal(without[i], with[i]) {
+			t.Errorf("%s: hoisting changed the output of render %d", name, i)
+			return
+		}
+	}
+}
+
+func TestHoistingSameOutput(t *testing.T) {
+	viewports := []*Viewport{nil, {CenterX: 0.3, CenterY: 0.7, Scale: 1.37, Rotation: 30}}
+	for cs := XY; cs <= CENTERED; cs++ {
+		for _, viewport := range viewports {
+			for seed := int64(0); seed < 4; seed++ {
+				rng := autoutils.ItemRand(seed, int64(cs))
+				config := Config{
+					FunctionLength: 40,
+					ColorSpace:     int(seed) % len(ColorSpaceNames),
+					CoordinateSys:  cs,
+					Rectifier:      []int{MOD, NORMALIZE, PERCENTILE, SIGMOID}[seed],
+					Viewport:       viewport,
+				}
+				pconfig := PaletteConfig{NColors: 4, FunctionLength: 40, CoordinateSys: cs, Viewport: viewport}
+				name := fmt.Sprintf("coordinates %d, viewport %v, seed %d", cs, viewport != nil, seed)
+				checkHoisting(t, name, RandomGenome(3, false, config, pconfig, rng), 37, 23)
+				checkHoisting(t, name+", paletted", RandomGenome(3, true, config, pconfig, rng), 37, 23)
+			}
+		}
+	}
+}
+
+func benchmarkHoisting(b *testing.B, hoist bool, video bool) {
+	genomes := make([]*Genome, 8)
+	for i := range genomes {
+		rng := autoutils.ItemRand(1, int64(i))
+		genomes[i] = RandomGenome(3, false, Config{FunctionLength: 40, noHoisting: !hoist}, PaletteConfig{}, rng)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g := genomes[i%len(genomes)]
+		if video {
+			g.Frames(160, 90, 4, 1, func(n int64, img image.Image) {})
+		} else {
+			g.Image(160, 90, 0)
+		}
+	}
+}
+
+func BenchmarkImage(b *testing.B)           { benchmarkHoisting(b, true, false) }
+func BenchmarkImageNoHoisting(b *testing.B) { benchmarkHoisting(b, false, false) }
+func BenchmarkVideo(b *testing.B)           { benchmarkHoisting(b, true, true) }
+func BenchmarkVideoNoHoisting(b *testing.B) { benchmarkHoisting(b, false, true) }
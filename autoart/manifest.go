@@ -0,0 +1,265 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Manifests
+
+A manifest is a JSON file saved next to each image, video, or audio file,
+recording everything that went into making it: the seed and item number of the
+batch, the size or length, the options (in the same format as a preset), the
+palette colors, and the functions (in the text format described in autoutils).
+For example:
+
+	{
+		"version": 1,
+		"kind": "image",
+		"seed": 1571234567890,
+		"item": 3,
+		"width": 1920,
+		"height": 1080,
+		"options": {
+			"name": "",
+			"palette": true,
+			...
+		},
+		"palette": ["#1f8a3cff", "#e0c2a1ff"],
+		"functions": ["autoart1 nvars=2 v0 v1 + 0.5 * sin"]
+	}
+
+Since the functions and palette are saved, the file can be made again from the
+manifest alone, even if the way random functions are generated changes.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image/color"
+	"io"
+	"os"
+	"strings"
+)
+
+const manifestVersion = 1
+
+const (
+	KindImage = "image"
+	KindVideo = "video"
+	KindAudio = "audio"
+)
+
+// A color written as "#rrggbbaa"
+type HexColor color.RGBA
+
+func (c HexColor) MarshalText() ([]byte, error) {
+	return []byte(fmt.Sprintf("#%02x%02x%02x%02x", c.R, c.G, c.B, c.A)), nil
+}
+
+func (c *HexColor) UnmarshalText(text []byte) error {
+	s := string(text)
+	if len(s) != 9 || !strings.HasPrefix(s, "#") {
+		return fmt.Errorf("invalid color: %q (should look like #rrggbbaa)", s)
+	}
+	_, err := fmt.Sscanf(s, "#%02x%02x%02x%02x", &c.R, &c.G, &c.B, &c.A)
+	if err != nil {
+		return fmt.Errorf("invalid color: %q (should look like #rrggbbaa)", s)
+	}
+	return nil
+}
+
+type Manifest struct {
+	Version int    `json:"version"`
+	Kind    string `json:"kind"`
+	Seed    int64  `json:"seed"`
+	Item    int64  `json:"item"`
+	// Images and videos only
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Time at which a three variable genome was rendered (images only)
+	Time float64 `json:"time,omitempty"`
+	// The lighting of a relief image (images only, nil if it isn't one)
+	Relief *Relief `json:"relief,omitempty"`
+	// Length in seconds (videos and audio only)
+	Length float64 `json:"length,omitempty"`
+	// Videos only
+	Framerate int `json:"framerate,omitempty"`
+	// Audio only
+	SampleRate int `json:"sampleRate,omitempty"`
+	// For audio, only the function length and rectifier are used.
+	Options   *Preset              `json:"options"`
+	Palette   []HexColor           `json:"palette,omitempty"`
+	Functions []autoutils.Function `json:"functions"`
+}
+
+func genomeManifest(kind string, seed int64, item int64, g *Genome) *Manifest {
+	m := &Manifest{
+		Version: manifestVersion,
+		Kind:    kind,
+		Seed:    seed,
+		Item:    item,
+		Options: &Preset{
+			Paletted:      g.Paletted,
+			Config:        g.Config,
+			PaletteConfig: g.PaletteConfig,
+		},
+		Functions: g.Functions,
+	}
+	for _, c := range g.Palette {
+		m.Palette = append(m.Palette, HexColor(c))
+	}
+	return m
+}
+
+// Returns a manifest for g, rendered as an image.
+func NewImageManifest(seed int64, item int64, width int, height int, g *Genome) *Manifest {
+	m := genomeManifest(KindImage, seed, item, g)
+	m.Width, m.Height = width, height
+	return m
+}
+
+// Returns a manifest for g, rendered as a video.
+func NewVideoManifest(seed int64, item int64, width int, height int, length float64, framerate int, g *Genome) *Manifest {
+	m := genomeManifest(KindVideo, seed, item, g)
+	m.Width, m.Height = width, height
+	m.Length, m.Framerate = length, framerate
+	return m
+}
+
+// Returns a manifest for audio generated from function.
+func NewAudioManifest(seed int64, item int64, length float64, sampleRate int, functionLength int, rectifier int, function *autoutils.Function) *Manifest {
+	return &Manifest{
+		Version:    manifestVersion,
+		Kind:       KindAudio,
+		Seed:       seed,
+		Item:       item,
+		Length:     length,
+		SampleRate: sampleRate,
+		Options: &Preset{Config: Config{
+			FunctionLength: functionLength,
+			Rectifier:      rectifier,
+		}},
+		Functions: []autoutils.Function{*function},
+	}
+}
+
+// Returns the genome saved in m. Audio manifests don't have genomes.
+func (m *Manifest) Genome() (*Genome, error) {
+	if m.Kind == KindAudio {
+		return nil, fmt.Errorf("audio manifests don't have a genome")
+	}
+	if m.Options == nil {
+		return nil, fmt.Errorf("manifest has no options")
+	}
+	g := &Genome{
+		Paletted:      m.Options.Paletted,
+		Config:        m.Options.Config,
+		PaletteConfig: m.Options.PaletteConfig,
+		Functions:     m.Functions,
+	}
+	nfunctions := g.Config.nFunctions()
+	if g.Paletted {
+		if len(m.Palette) != g.PaletteConfig.NColors {
+			return nil, fmt.Errorf("manifest has %d colors, but should have %d", len(m.Palette), g.PaletteConfig.NColors)
+		}
+		g.Palette = make([]color.RGBA, len(m.Palette))
+		for i, c := range m.Palette {
+			g.Palette[i] = color.RGBA(c)
+		}
+		nfunctions = g.PaletteConfig.NColors - 1
+	}
+	if len(g.Functions) != nfunctions {
+		return nil, fmt.Errorf("manifest has %d functions, but should have %d", len(g.Functions), nfunctions)
+	}
+	for i := range g.Functions {
+		// The variables are the coordinates, and maybe the time.
+		if n := g.Functions[i].NVars(); n != 2 && n != 3 {
+			return nil, fmt.Errorf("function %d has %d variables, but should have 2 or 3", i+1, n)
+		}
+	}
+	return g, nil
+}
+
+func (m *Manifest) validate() error {
+	if m.Version != manifestVersion {
+		return fmt.Errorf("unsupported manifest version: %d", m.Version)
+	}
+	switch m.Kind {
+	case KindImage, KindVideo, KindAudio:
+	default:
+		return fmt.Errorf("unknown manifest kind: %q", m.Kind)
+	}
+	if m.Kind == KindAudio && len(m.Functions) != 1 {
+		return fmt.Errorf("audio manifests should have 1 function, not %d", len(m.Functions))
+	}
+	if m.Kind == KindAudio && m.Functions[0].NVars() != 1 {
+		return fmt.Errorf("the function of an audio manifest should have 1 variable, not %d", m.Functions[0].NVars())
+	}
+	return nil
+}
+
+// Reads a manifest in JSON format.
+func ReadManifest(r io.Reader) (*Manifest, error) {
+	m := new(Manifest)
+	if err := json.NewDecoder(r).Decode(m); err != nil {
+		return nil, err
+	}
+	if err := m.validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Loads a manifest from a JSON file.
+func LoadManifest(filename string) (*Manifest, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	m, err := ReadManifest(file)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %v", filename, err)
+	}
+	return m, nil
+}
+
+// Writes m in JSON format.
+func (m *Manifest) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Saves m to a JSON file.
+func (m *Manifest) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = m.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
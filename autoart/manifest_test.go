@@ -0,0 +1,68 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"bytes"
+	"github.com/pommicket/autoart/autoutils"
+	"testing"
+)
+
+func TestManifestVariables(t *testing.T) {
+	g := RandomGenome(2, false, Config{ColorSpace: GRAYSCALE}, PaletteConfig{}, autoutils.ItemRand(1, 0))
+	for _, text := range []string{"autoart1 nvars=0 1", "autoart1 nvars=1 v0", "autoart1 nvars=4 v3"} {
+		f, err := autoutils.ParseFunction(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		functions := make([]autoutils.Function, len(g.Functions))
+		for i := range functions {
+			functions[i] = f
+		}
+		m := NewImageManifest(1, 0, 8, 8, &Genome{Config: g.Config, Functions: functions})
+		if _, err = m.Genome(); err == nil {
+			t.Errorf("%s: got a genome from a manifest with a function of %d variables", text, f.NVars())
+		}
+		if f.NVars() == 1 {
+			continue
+		}
+		m = NewAudioManifest(1, 0, 1, 8000, 10, MOD, &f)
+		var b bytes.Buffer
+		if err = m.Write(&b); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = ReadManifest(&b); err == nil {
+			t.Errorf("%s: read an audio manifest with a function of %d variables", text, f.NVars())
+		}
+	}
+	m := NewImageManifest(1, 0, 8, 8, g)
+	if _, err := m.Genome(); err != nil {
+		t.Error(err)
+	}
+	var f autoutils.Function
+	f.Generate(1, 10, autoutils.ItemRand(1, 0))
+	var b bytes.Buffer
+	if err := NewAudioManifest(1, 0, 1.5, 8000, 10, MOD, &f).Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(&b); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+// Names of color spaces, rectifiers, and coordinate systems, for use in
+// command line flags, files, etc. More coordinate systems can be added with
+// RegisterCoordinateSys.
+
+import (
+	"fmt"
+	"strings"
+)
+
+var ColorSpaceNames = []string{
+	RGB:       "rgb",
+	GRAYSCALE: "grayscale",
+	CMYK:      "cmyk",
+	HSV:       "hsv",
+	YCbCr:     "ycbcr",
+	HSL:       "hsl",
+	CIELAB:    "cielab",
+	OKLab:     "oklab",
+	OKLCh:     "oklch",
+}
+
+var RectifierNames = []string{
+	MOD:        "mod",
+	CLAMP:      "clamp",
+	SIGMOID:    "sigmoid",
+	NORMALIZE:  "normalize",
+	MIRROR:     "mirror",
+	TANH:       "tanh",
+	SINE:       "sine",
+	PERCENTILE: "percentile",
+}
+
+var CoordinateSysNames = []string{
+	XY:       "xy",
+	RTHETA:   "rtheta",
+	LOGPOLAR: "logpolar",
+	ELLIPTIC: "elliptic",
+	POINCARE: "poincare",
+	FISHEYE:  "fisheye",
+	CENTERED: "centered",
+}
+
+func parseName(kind string, names []string, name string) (int, error) {
+	for i, n := range names {
+		if strings.EqualFold(n, name) {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown %s %q (should be one of: %s)", kind, name, strings.Join(names, ", "))
+}
+
+func ParseColorSpace(name string) (int, error) {
+	return parseName("color space", ColorSpaceNames, name)
+}
+
+func ParseRectifier(name string) (int, error) {
+	return parseName("rectifier", RectifierNames, name)
+}
+
+func ParseCoordinateSys(name string) (int, error) {
+	return parseName("coordinate system", CoordinateSysNames, name)
+}
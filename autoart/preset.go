@@ -0,0 +1,277 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Presets
+
+A preset is a named set of options, saved as a JSON file like this:
+
+	{
+		"name": "polar HSV sigmoid",
+		"palette": false,
+		"functionLength": 60,
+		"colorSpace": "hsv",
+		"rectifier": "sigmoid",
+		"rectifiers": ["sigmoid", "mirror", "tanh"],
+		"coordinateSystem": "rtheta",
+		"alpha": false,
+		"colors": 10,
+		"grammar": {"operators": {"tan": 0, "sin": 3, "cos": 3}},
+		"viewport": {"centerX": 0.25, "centerY": 0.5, "scale": 4, "rotation": 30, "preserveAspect": true}
+	}
+
+Any of the fields can be left out, in which case the default is used. The
+grammar format is described in autoutils.
+colorSpace, rectifier, and rectifiers only apply without a palette, and colors
+only applies with a palette. rectifiers gives each function its own rectifier
+(e.g. one for hue, one for saturation, and one for value), and overrides
+rectifier. viewport chooses which part of the coordinate system is shown (see
+Viewport).
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"io"
+	"os"
+)
+
+type Preset struct {
+	Name          string
+	Paletted      bool
+	Config        Config
+	PaletteConfig PaletteConfig
+}
+
+// The JSON representation of a preset
+type presetFile struct {
+	Name             string `json:"name"`
+	Palette          bool   `json:"palette"`
+	FunctionLength   int    `json:"functionLength"`
+	ColorSpace       string `json:"colorSpace"`
+	Rectifier        string `json:"rectifier"`
+	CoordinateSystem string `json:"coordinateSystem"`
+	Alpha            bool   `json:"alpha"`
+	Colors           int    `json:"colors"`
+	// nil to use rectifier for every function
+	Rectifiers []string `json:"rectifiers,omitempty"`
+	// nil for the default grammar
+	Grammar *autoutils.Grammar `json:"grammar,omitempty"`
+	// nil to show the whole canvas
+	Viewport *Viewport `json:"viewport,omitempty"`
+}
+
+const defaultNColors = 10
+
+func (c *Config) Validate() error {
+	if c.FunctionLength < 0 {
+		return fmt.Errorf("function length can't be negative")
+	}
+	if c.ColorSpace < 0 || c.ColorSpace >= len(ColorSpaceNames) {
+		return fmt.Errorf("invalid color space: %d", c.ColorSpace)
+	}
+	if c.Rectifier < 0 || c.Rectifier >= len(RectifierNames) {
+		return fmt.Errorf("invalid rectifier: %d", c.Rectifier)
+	}
+	if c.Rectifiers != nil && len(c.Rectifiers) != c.nFunctions() {
+		return fmt.Errorf("there are %d rectifiers, but %d functions", len(c.Rectifiers), c.nFunctions())
+	}
+	for _, r := range c.Rectifiers {
+		if r < 0 || r >= len(RectifierNames) {
+			return fmt.Errorf("invalid rectifier: %d", r)
+		}
+	}
+	if c.CoordinateSys < 0 || c.CoordinateSys >= len(CoordinateSysNames) {
+		return fmt.Errorf("invalid coordinate system: %d", c.CoordinateSys)
+	}
+	if c.Viewport != nil {
+		if err := c.Viewport.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Grammar != nil {
+		return c.Grammar.Validate()
+	}
+	return nil
+}
+
+func (c *PaletteConfig) Validate() error {
+	if c.NColors <= 0 {
+		return fmt.Errorf("a palette needs at least 1 color")
+	}
+	if c.FunctionLength <= 0 {
+		return fmt.Errorf("function length must be positive")
+	}
+	if c.CoordinateSys < 0 || c.CoordinateSys >= len(CoordinateSysNames) {
+		return fmt.Errorf("invalid coordinate system: %d", c.CoordinateSys)
+	}
+	if c.Viewport != nil {
+		if err := c.Viewport.Validate(); err != nil {
+			return err
+		}
+	}
+	if c.Grammar != nil {
+		return c.Grammar.Validate()
+	}
+	return nil
+}
+
+func (p *Preset) UnmarshalJSON(data []byte) error {
+	file := presetFile{
+		FunctionLength:   defaultFunctionLength,
+		ColorSpace:       ColorSpaceNames[RGB],
+		Rectifier:        RectifierNames[MOD],
+		CoordinateSystem: CoordinateSysNames[XY],
+		Colors:           defaultNColors,
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&file); err != nil {
+		return err
+	}
+
+	q := Preset{Name: file.Name, Paletted: file.Palette}
+	var err error
+	if q.Config.ColorSpace, err = ParseColorSpace(file.ColorSpace); err != nil {
+		return err
+	}
+	if q.Config.Rectifier, err = ParseRectifier(file.Rectifier); err != nil {
+		return err
+	}
+	for _, name := range file.Rectifiers {
+		r, err := ParseRectifier(name)
+		if err != nil {
+			return err
+		}
+		q.Config.Rectifiers = append(q.Config.Rectifiers, r)
+	}
+	if q.Config.CoordinateSys, err = ParseCoordinateSys(file.CoordinateSystem); err != nil {
+		return err
+	}
+	q.Config.FunctionLength = file.FunctionLength
+	q.Config.Alpha = file.Alpha
+	q.Config.Grammar = file.Grammar
+	q.Config.Viewport = file.Viewport
+	q.PaletteConfig = PaletteConfig{
+		NColors:        file.Colors,
+		Alpha:          file.Alpha,
+		FunctionLength: file.FunctionLength,
+		CoordinateSys:  q.Config.CoordinateSys,
+		Grammar:        file.Grammar,
+		Viewport:       file.Viewport,
+	}
+	if err = q.validate(); err != nil {
+		return err
+	}
+	*p = q
+	return nil
+}
+
+// Reads a preset in JSON format.
+func ReadPreset(r io.Reader) (*Preset, error) {
+	p := new(Preset)
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Loads a preset from a JSON file.
+func LoadPreset(filename string) (*Preset, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	p, err := ReadPreset(file)
+	if err != nil {
+		return nil, fmt.Errorf("preset %s: %v", filename, err)
+	}
+	return p, nil
+}
+
+func (p *Preset) validate() error {
+	if p.Paletted {
+		if err := p.PaletteConfig.Validate(); err != nil {
+			return err
+		}
+	}
+	return p.Config.Validate()
+}
+
+func (p *Preset) MarshalJSON() ([]byte, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	file := presetFile{
+		Name:             p.Name,
+		Palette:          p.Paletted,
+		FunctionLength:   p.Config.FunctionLength,
+		ColorSpace:       ColorSpaceNames[p.Config.ColorSpace],
+		Rectifier:        RectifierNames[p.Config.Rectifier],
+		CoordinateSystem: CoordinateSysNames[p.Config.CoordinateSys],
+		Alpha:            p.Config.Alpha,
+		Colors:           p.PaletteConfig.NColors,
+		Grammar:          p.Config.Grammar,
+		Viewport:         p.Config.Viewport,
+	}
+	for _, r := range p.Config.Rectifiers {
+		file.Rectifiers = append(file.Rectifiers, RectifierNames[r])
+	}
+	if p.Paletted {
+		file.FunctionLength = p.PaletteConfig.FunctionLength
+		file.Grammar = p.PaletteConfig.Grammar
+		file.CoordinateSystem = CoordinateSysNames[p.PaletteConfig.CoordinateSys]
+		file.Alpha = p.PaletteConfig.Alpha
+		file.Viewport = p.PaletteConfig.Viewport
+	} else if file.Colors == 0 {
+		file.Colors = defaultNColors
+	}
+	if file.FunctionLength == 0 {
+		file.FunctionLength = defaultFunctionLength
+	}
+	return json.Marshal(&file)
+}
+
+// Writes p in JSON format.
+func (p *Preset) Write(w io.Writer) error {
+	data, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// Saves p to a JSON file.
+func (p *Preset) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	if err = p.Write(file); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,277 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+// Automatic rejection of boring images (flat colors, noise, etc.)
+
+import (
+	"bytes"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"image/png"
+	"math"
+	"math/rand"
+)
+
+// A Sample is a small render of some functions, which can be scored to guess
+// whether a full size render would be any good.
+type Sample struct {
+	Image *image.RGBA
+	// Values[i] holds the output of function i at each pixel (in the same
+	// order as Image.Pix), before it was turned into a color.
+	Values [][]float64
+	genome *Genome
+	ranges []autoutils.Interval
+}
+
+// Returns the estimated ranges of the functions (see Genome.Ranges), or nil if
+// the sample wasn't rendered from a genome.
+func (s *Sample) Ranges() []autoutils.Interval {
+	if s.ranges == nil && s.genome != nil {
+		s.ranges = s.genome.Ranges(0)
+	}
+	return s.ranges
+}
+
+// A Scorer measures something about a sample. Scores should be between 0 and 1.
+type Scorer interface {
+	Score(s *Sample) float64
+}
+
+type ScorerFunc func(s *Sample) float64
+
+func (f ScorerFunc) Score(s *Sample) float64 {
+	return f(s)
+}
+
+var (
+	// Average entropy of the red, green, and blue channels, divided by 8 (the
+	// maximum entropy of an 8-bit channel). Flat images score 0.
+	Entropy Scorer = ScorerFunc(entropy)
+	// Fraction of pixels which are very different from the pixel to their
+	// right or the pixel below them. Smooth images score close to 0, and
+	// noise scores close to 1.
+	EdgeDensity Scorer = ScorerFunc(edgeDensity)
+	// Size of the image as a PNG, divided by its uncompressed size. Flat
+	// images score close to 0, and noise scores close to 1.
+	CompressionRatio Scorer = ScorerFunc(compressionRatio)
+	// Fraction of function outputs which are NaN or infinite.
+	NaNFraction Scorer = ScorerFunc(nanFraction)
+	// Average variance of the red, green, and blue channels (as numbers from 0
+	// to 1), multiplied by 4 so that it is between 0 and 1.
+	ColorVariance Scorer = ScorerFunc(colorVariance)
+	// Fraction of functions whose estimated ranges are unbounded. Use a
+	// maximum of 0 to only accept functions which NORMALIZE can map onto 0-1.
+	UnboundedFraction Scorer = ScorerFunc(unboundedFraction)
+)
+
+func entropy(s *Sample) float64 {
+	var histograms [3][256]int
+	pix := s.Image.Pix
+	for i := 0; i < len(pix); i += 4 {
+		for c := 0; c < 3; c++ {
+			histograms[c][pix[i+c]]++
+		}
+	}
+	npixels := float64(len(pix) / 4)
+	total := 0.0
+	for c := range histograms {
+		for _, count := range histograms[c] {
+			if count > 0 {
+				p := float64(count) / npixels
+				total -= p * math.Log2(p)
+			}
+		}
+	}
+	return total / 3 / 8
+}
+
+func edgeDensity(s *Sample) float64 {
+	const edgeThreshold = 48
+	img := s.Image
+	width, height := img.Rect.Dx(), img.Rect.Dy()
+	different := func(i, j int) bool {
+		for c := 0; c < 3; c++ {
+			d := int(img.Pix[i+c]) - int(img.Pix[j+c])
+			if d > edgeThreshold || d < -edgeThreshold {
+				return true
+			}
+		}
+		return false
+	}
+	edges := 0
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			if (x+1 < width && different(i, i+4)) || (y+1 < height && different(i, i+img.Stride)) {
+				edges++
+			}
+		}
+	}
+	return float64(edges) / float64(width*height)
+}
+
+func compressionRatio(s *Sample) float64 {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, s.Image); err != nil {
+		return 0
+	}
+	return math.Min(1, float64(buf.Len())/float64(len(s.Image.Pix)))
+}
+
+func nanFraction(s *Sample) float64 {
+	bad, total := 0, 0
+	for _, values := range s.Values {
+		for _, v := range values {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				bad++
+			}
+		}
+		total += len(values)
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(bad) / float64(total)
+}
+
+func colorVariance(s *Sample) float64 {
+	pix := s.Image.Pix
+	npixels := float64(len(pix) / 4)
+	total := 0.0
+	for c := 0; c < 3; c++ {
+		var sum, sumSquares float64
+		for i := c; i < len(pix); i += 4 {
+			v := float64(pix[i]) / 255
+			sum += v
+			sumSquares += v * v
+		}
+		mean := sum / npixels
+		total += sumSquares/npixels - mean*mean
+	}
+	return total / 3 * 4
+}
+
+func unboundedFraction(s *Sample) float64 {
+	ranges := s.Ranges()
+	if len(ranges) == 0 {
+		return 0
+	}
+	unbounded := 0
+	for _, r := range ranges {
+		if !r.Bounded() {
+			unbounded++
+		}
+	}
+	return float64(unbounded) / float64(len(ranges))
+}
+
+// A Threshold accepts samples which a Scorer gives a score between Min and Max.
+type Threshold struct {
+	Scorer Scorer
+	Min    float64
+	Max    float64
+}
+
+/*
+A QualityFilter decides whether some functions are worth rendering at full
+size, by rendering a small sample and checking it against all the thresholds.
+If MaxAttempts sets of functions are rejected in a row, the last one is used
+anyways.
+*/
+type QualityFilter struct {
+	Thresholds  []Threshold
+	ProbeWidth  int
+	ProbeHeight int
+	MaxAttempts int
+}
+
+// Returns a filter which rejects flat colors, gradients, and noise.
+func DefaultQualityFilter() *QualityFilter {
+	return &QualityFilter{
+		Thresholds: []Threshold{
+			{Entropy, 0.3, 1},
+			{EdgeDensity, 0.01, 0.5},
+			{CompressionRatio, 0.05, 0.8},
+			{NaNFraction, 0, 0.1},
+			{ColorVariance, 0.02, 1},
+		},
+		ProbeWidth:  96,
+		ProbeHeight: 54,
+		MaxAttempts: 20,
+	}
+}
+
+func (q *QualityFilter) Accept(s *Sample) bool {
+	for _, t := range q.Thresholds {
+		score := t.Scorer.Score(s)
+		if !(score >= t.Min && score <= t.Max) {
+			return false
+		}
+	}
+	return true
+}
+
+// Renders a sample of g for q.
+func (q *QualityFilter) sample(g *Genome) *Sample {
+	width, height := q.ProbeWidth, q.ProbeHeight
+	s := &Sample{
+		Image:  g.Image(width, height, 0).(*image.RGBA),
+		Values: make([][]float64, len(g.Functions)),
+		genome: g,
+	}
+	m := g.pixelMap()
+	vars := make([]float64, 3)
+	compiled := compileFunctions(g.Functions)
+	for i := range s.Values {
+		s.Values[i] = make([]float64, 0, width*height)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			m.set(vars, x, y, width, height)
+			for i, c := range compiled {
+				s.Values[i] = append(s.Values[i], c.Evaluate(vars))
+			}
+		}
+	}
+	return s
+}
+
+// Like RandomGenome, but keeps trying new genomes until q accepts one.
+func (q *QualityFilter) RandomGenome(nvars int, paletted bool, config Config, pconfig PaletteConfig, rng *rand.Rand) *Genome {
+	for attempt := 1; ; attempt++ {
+		g := RandomGenome(nvars, paletted, config, pconfig, rng)
+		if attempt >= q.MaxAttempts || q.Accept(q.sample(g)) {
+			return g
+		}
+	}
+}
+
+// Like GenerateImage, but keeps trying new functions until filter accepts
+// them.
+func GenerateImageFiltered(width int, height int, config Config, filter *QualityFilter, rng *rand.Rand) image.Image {
+	return filter.RandomGenome(2, false, config, PaletteConfig{}, rng).Image(width, height, 0)
+}
+
+// Like GenerateImagePalette, but keeps trying new palettes and functions until
+// filter accepts them.
+func GenerateImagePaletteFiltered(width int, height int, conf PaletteConfig, filter *QualityFilter, rng *rand.Rand) image.Image {
+	return filter.RandomGenome(2, true, Config{}, conf, rng).Image(width, height, 0)
+}
@@ -0,0 +1,173 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Ranges
+
+Whether an image looks good depends a lot on the range of values its functions
+take: if they only go from 0.2 to 0.3, the image is washed out, and if they go
+from -100 to 100, MOD turns it into noise and CLAMP saturates it. The range of
+each function over the image is estimated with interval arithmetic (see
+autoutils.Function.Range), and the NORMALIZE rectifier maps it onto 0-1.
+Since the estimate can be bigger than the real range, normalized images can
+still be a bit washed out, but never saturated.
+
+The ranges don't depend on the size of the image, so a small preview is
+normalized in the same way as a full size render. For videos, the ranges are
+over the whole video, so the brightness doesn't jump around from frame to
+frame, and for audio, they're over the whole length.
+
+The PERCENTILE rectifier samples the values of each function first, on a grid
+of at most 128x128 pixels (and a few frames of a video), and maps the middle
+98% of them onto 0-1. This range is much closer, but a few pixels are
+saturated, and the range can't be known without rendering.
+*/
+
+import (
+	"github.com/pommicket/autoart/autoutils"
+	"math"
+	"sort"
+)
+
+// How many pieces the domain of each variable is split into when estimating
+// ranges
+const rangeDivisions = 16
+
+const (
+	// The width and height of the grid sampled for PERCENTILE
+	percentileProbeSize = 128
+	// How many frames of a video are sampled for PERCENTILE
+	percentileFrames = 8
+	// The fraction of values below the range of PERCENTILE (and above it)
+	percentileCutoff = 0.01
+)
+
+// Returns estimates of the ranges of functions over an image, with t between
+// time.Min and time.Max (if they depend on t).
+func functionRanges(functions []autoutils.Function, m pixelMap, time autoutils.Interval) []autoutils.Interval {
+	domain := append(m.domain()[:2:2], time)
+	ranges := make([]autoutils.Interval, len(functions))
+	for i := range functions {
+		ranges[i] = functions[i].Range(domain[:functions[i].NVars()], rangeDivisions)
+	}
+	return ranges
+}
+
+// Returns estimates of the ranges of g's functions over an image rendered at
+// the given time.
+func (g *Genome) Ranges(time float64) []autoutils.Interval {
+	return functionRanges(g.Functions, g.pixelMap(), autoutils.Interval{Min: time, Max: time})
+}
+
+// Returns the numbers of g's functions which use NORMALIZE, but whose ranges are
+// unbounded at the given time, so they can't be mapped onto 0-1.
+func (g *Genome) Unbounded(time float64) []int {
+	if g.Paletted {
+		return nil
+	}
+	var unbounded []int
+	for i, rectifier := range g.Config.rectifiers(len(g.Functions)) {
+		if rectifier != NORMALIZE {
+			continue
+		}
+		r := functionRanges(g.Functions[i:i+1], g.Config.pixelMap(), autoutils.Interval{Min: time, Max: time})[0]
+		if !r.Bounded() {
+			unbounded = append(unbounded, i)
+		}
+	}
+	return unbounded
+}
+
+// Returns the range of values between the percentileCutoff and
+// 1-percentileCutoff quantiles, ignoring NaN and infinity.
+func percentileRange(values []float64) autoutils.Interval {
+	finite := make([]float64, 0, len(values))
+	for _, v := range values {
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			finite = append(finite, v)
+		}
+	}
+	if len(finite) == 0 {
+		return autoutils.Interval{Min: math.Inf(-1), Max: math.Inf(1)}
+	}
+	sort.Float64s(finite)
+	last := float64(len(finite) - 1)
+	return autoutils.Interval{
+		Min: finite[int(percentileCutoff*last)],
+		Max: finite[int((1-percentileCutoff)*last)],
+	}
+}
+
+// Returns the PERCENTILE range of f over a width by height image, with t
+// between time.Min and time.Max. The image is sampled on a grid with the same
+// aspect ratio, so the range doesn't depend on the size.
+func sampledRange(f *autoutils.Function, m pixelMap, width int, height int, time autoutils.Interval) autoutils.Interval {
+	scale := float64(percentileProbeSize) / math.Max(float64(width), float64(height))
+	probeWidth := int(math.Max(1, math.Round(float64(width)*scale)))
+	probeHeight := int(math.Max(1, math.Round(float64(height)*scale)))
+	frames := 1
+	if time.Max > time.Min {
+		frames = percentileFrames
+	}
+	compiled := f.Compile()
+	vars := make([]float64, 3)
+	values := make([]float64, 0, frames*probeWidth*probeHeight)
+	for frame := 0; frame < frames; frame++ {
+		vars[2] = time.Min
+		if frames > 1 {
+			vars[2] += (time.Max - time.Min) * float64(frame) / float64(frames-1)
+		}
+		for y := 0; y < probeHeight; y++ {
+			for x := 0; x < probeWidth; x++ {
+				m.set(vars, x, y, probeWidth, probeHeight)
+				values = append(values, compiled.Evaluate(vars))
+			}
+		}
+	}
+	return percentileRange(values)
+}
+
+// Returns the range that the rectifier of each function maps onto 0-1, over a
+// width by height image with t between time.Min and time.Max. Rectifiers
+// other than NORMALIZE and PERCENTILE don't use a range, so theirs are left
+// empty.
+func rectifierRanges(functions []autoutils.Function, rectifiers []int, m pixelMap,
+	width int, height int, time autoutils.Interval) []autoutils.Interval {
+	ranges := make([]autoutils.Interval, len(functions))
+	for i := range functions {
+		switch rectifiers[i] {
+		case NORMALIZE:
+			ranges[i] = functionRanges(functions[i:i+1], m, time)[0]
+		case PERCENTILE:
+			ranges[i] = sampledRange(&functions[i], m, width, height, time)
+		}
+	}
+	return ranges
+}
+
+// Maps x from r to 0-1. If r is unbounded (or a single value), x goes through
+// sigmoid instead.
+func normalize(x float64, r autoutils.Interval) float64 {
+	if !r.Bounded() || r.Max == r.Min {
+		return sigmoid(x)
+	}
+	return math.Max(0, math.Min(1, (x-r.Min)/(r.Max-r.Min)))
+}
@@ -0,0 +1,135 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Relief
+
+A relief render treats one of the functions of a genome as a heightfield, and
+lights the image with a directional light as if it were embossed with that
+height. The normals of the heightfield come from the exact derivatives of the
+function (see autoutils.Function.Derivative), so they don't have the blocky
+artifacts of taking differences between neighboring pixels.
+*/
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"math"
+)
+
+type Relief struct {
+	// Which function is the height (for a palette, the function of that color)
+	Channel int `json:"channel"`
+	// How tall the heightfield is. With a strength of 1, a height of 1 is as
+	// tall as the image is wide (or high).
+	Strength float64 `json:"strength"`
+	// The direction the light comes from, in degrees clockwise from the top of
+	// the image
+	Azimuth float64 `json:"azimuth"`
+	// The angle of the light above the image, in degrees
+	Elevation float64 `json:"elevation"`
+	// How bright the parts facing away from the light are, from 0 to 1
+	Ambient float64 `json:"ambient"`
+}
+
+// Returns a relief of the first function, lit from the top left.
+func DefaultRelief() *Relief {
+	return &Relief{
+		Channel:   0,
+		Strength:  0.05,
+		Azimuth:   315,
+		Elevation: 45,
+		Ambient:   0.2,
+	}
+}
+
+func (r *Relief) Validate(g *Genome) error {
+	if r.Channel < 0 || r.Channel >= len(g.Functions) {
+		return fmt.Errorf("relief channel should be between 0 and %d, not %d", len(g.Functions)-1, r.Channel)
+	}
+	if r.Strength < 0 {
+		return fmt.Errorf("relief strength can't be negative")
+	}
+	if r.Elevation <= 0 || r.Elevation > 90 {
+		return fmt.Errorf("light elevation should be more than 0 and at most 90 degrees, not %v", r.Elevation)
+	}
+	if r.Ambient < 0 || r.Ambient > 1 {
+		return fmt.Errorf("ambient light should be between 0 and 1, not %v", r.Ambient)
+	}
+	return nil
+}
+
+// Renders g at the given time, with the relief r.
+func (g *Genome) ReliefImage(width int, height int, time float64, r *Relief) (image.Image, error) {
+	if err := r.Validate(g); err != nil {
+		return nil, err
+	}
+	img := g.Image(width, height, time).(*image.RGBA)
+	m := g.pixelMap()
+	f := &g.Functions[r.Channel]
+	functions := []autoutils.Function{*f, f.Derivative(0), f.Derivative(1)}
+	frame := newHoister(functions, m, width, height, false, g.hoisting()).frame([]float64{0, 0, time})
+	var rectifier int
+	var rectifierRange autoutils.Interval
+	if !g.Paletted {
+		rectifier = g.Config.rectifiers(len(g.Functions))[r.Channel]
+		rectifierRange = rectifierRanges(g.Functions[r.Channel:r.Channel+1], []int{rectifier},
+			m, width, height, autoutils.Interval{Min: time, Max: time})[0]
+	}
+
+	azimuth, elevation := r.Azimuth*math.Pi/180, r.Elevation*math.Pi/180
+	// The direction to the light, with x to the right, y down, and z up out of
+	// the image
+	lx := math.Cos(elevation) * math.Sin(azimuth)
+	ly := -math.Cos(elevation) * math.Cos(azimuth)
+	lz := math.Sin(elevation)
+	// Heights are measured in units of the size of the image
+	scale := r.Strength * float64(width+height) / 2
+	parallelRows(height, func() func(y int) {
+		evaluate := frame.evaluator()
+		return func(y int) {
+			row := img.Pix[y*img.Stride:]
+			for x := 0; x < width; x++ {
+				slope := 1.0
+				if !g.Paletted {
+					slope = rectifierSlope(evaluate(0, x, y), rectifier, rectifierRange)
+				}
+				h0, h1 := evaluate(1, x, y), evaluate(2, x, y)
+				v0x, v0y, v1x, v1y := m.jacobian(x, y, width, height)
+				// The slope of the heightfield in pixels per pixel
+				hx := scale * slope * (h0*v0x + h1*v1x)
+				hy := scale * slope * (h0*v0y + h1*v1y)
+				if math.IsNaN(hx) || math.IsInf(hx, 0) || math.IsNaN(hy) || math.IsInf(hy, 0) {
+					hx, hy = 0, 0
+				}
+				// The normal is (-hx, -hy, 1), normalized. Flat parts keep
+				// their color, and the rest are lighter or darker.
+				light := math.Max(0, (-hx*lx-hy*ly+lz)/math.Sqrt(hx*hx+hy*hy+1))
+				shade := r.Ambient + (1-r.Ambient)*light/lz
+				for c := 4 * x; c < 4*x+3; c++ {
+					row[c] = uint8(math.Min(255, float64(row[c])*shade))
+				}
+			}
+		}
+	})
+	return img, nil
+}
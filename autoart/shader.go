@@ -0,0 +1,347 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Shaders
+
+A genome can be written as a GLSL ES 3.00 fragment shader, which renders it
+the same way Genome.Image does (at any size), with t = iTime (plus a fixed
+offset) for videos. The shader has a Shadertoy-style mainImage function, and
+uniforms for the resolution and time:
+
+	uniform vec3 iResolution; // Width and height in pixels
+	uniform float iTime;      // Time in seconds
+
+GPUs use 32-bit floats, so the output can differ a little from the CPU's (see
+autoutils.GLSL).
+*/
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"io"
+	"strings"
+)
+
+const shaderHeader = `#version 300 es
+// Made by AutoArt (https://github.com/pommicket/autoart)
+precision highp float;
+precision highp int;
+
+uniform vec3 iResolution; // Width and height in pixels
+uniform float iTime;      // Time in seconds
+`
+
+const shadertoyHeader = `// Made by AutoArt (https://github.com/pommicket/autoart)
+`
+
+const shaderFooter = `
+out vec4 aa_fragColor;
+
+void main() {
+	mainImage(aa_fragColor, gl_FragCoord.xy);
+}
+`
+
+// Returns 255 * x as a byte, the same way Go converts it.
+const shaderByte = `
+int aa_byte(float x) {
+	x *= 255.0;
+	return isnan(x) || isinf(x) ? 0 : int(x) & 255;
+}
+`
+
+var shaderRectifiers = []string{
+	MOD:     "x - trunc(x)",
+	CLAMP:   "x > 1.0 ? 1.0 : 0.0",
+	SIGMOID: "1.0 / (1.0 + exp(-x))",
+	// Functions using these are mapped from their ranges before they are
+	// rectified (see shaderNormalize).
+	NORMALIZE:  "x > 1.0 ? 1.0 : (x < 0.0 ? 0.0 : x)",
+	PERCENTILE: "x > 1.0 ? 1.0 : (x < 0.0 ? 0.0 : x)",
+	MIRROR:     "x - 2.0 * floor(x / 2.0) > 1.0 ? 2.0 - (x - 2.0 * floor(x / 2.0)) : x - 2.0 * floor(x / 2.0)",
+	TANH:       "0.5 + 0.5 * tanh(x)",
+	SINE:       "0.5 - 0.5 * cos(3.14159265358979 * x)",
+}
+
+// Returns an expression which maps expression from r to 0-1 the way normalize
+// does, before it is clamped.
+func shaderNormalize(expression string, r autoutils.Interval) string {
+	if !r.Bounded() || r.Max == r.Min {
+		return fmt.Sprintf("1.0 / (1.0 + exp(-(%s)))", expression)
+	}
+	return fmt.Sprintf("((%s) - %s) / %s", expression, autoutils.GLSLFloat(r.Min), autoutils.GLSLFloat(r.Max-r.Min))
+}
+
+// Converts CIELAB to linear RGB, like autoutils.cielabToLinear.
+const shaderCIELAB = `
+float aa_lab_finv(float t) {
+	return t > 6.0 / 29.0 ? t * t * t : 3.0 * (6.0 / 29.0) * (6.0 / 29.0) * (t - 4.0 / 29.0);
+}
+
+vec3 aa_to_linear(vec3 lab) {
+	float fy = (lab.x + 16.0) / 116.0;
+	float x = 0.95047 * aa_lab_finv(fy + lab.y / 500.0);
+	float y = aa_lab_finv(fy);
+	float z = 1.08883 * aa_lab_finv(fy - lab.z / 200.0);
+	return vec3(3.2404542 * x - 1.5371385 * y - 0.4985314 * z,
+		-0.9692660 * x + 1.8760108 * y + 0.0415560 * z,
+		0.0556434 * x - 0.2040259 * y + 1.0572252 * z);
+}
+`
+
+// Converts OKLab to linear RGB, like autoutils.oklabToLinear.
+const shaderOKLab = `
+vec3 aa_to_linear(vec3 lab) {
+	float l = lab.x + 0.3963377774 * lab.y + 0.2158037573 * lab.z;
+	float m = lab.x - 0.1055613458 * lab.y - 0.0638541728 * lab.z;
+	float s = lab.x - 0.0894841775 * lab.y - 1.2914855480 * lab.z;
+	l = l * l * l;
+	m = m * m * m;
+	s = s * s * s;
+	return vec3(4.0767416621 * l - 3.3077115913 * m + 0.2309699292 * s,
+		-1.2684380046 * l + 2.6097574011 * m - 0.3413193965 * s,
+		-0.0041960863 * l - 0.7034186147 * m + 1.7076147010 * s);
+}
+`
+
+// Brings a color into the sRGB gamut by reducing its chroma, and encodes it,
+// like autoutils.gamutMap.
+const shaderGamutMap = `
+bool aa_in_gamut(vec3 c) {
+	return min(c.x, min(c.y, c.z)) >= -1e-6 && max(c.x, max(c.y, c.z)) <= 1.0 + 1e-6;
+}
+
+float aa_encode_srgb(float c) {
+	c = clamp(c, 0.0, 1.0);
+	c = c <= 0.0031308 ? 12.92 * c : 1.055 * pow(c, 1.0 / 2.4) - 0.055;
+	return floor(255.0 * c + 0.5);
+}
+
+vec3 aa_gamut_map(vec3 lab) {
+	vec3 c = aa_to_linear(lab);
+	if (!aa_in_gamut(c)) {
+		float lo = 0.0, hi = 1.0;
+		for (int i = 0; i < 20; i++) {
+			float mid = (lo + hi) / 2.0;
+			if (aa_in_gamut(aa_to_linear(vec3(lab.x, mid * lab.y, mid * lab.z)))) {
+				lo = mid;
+			} else {
+				hi = mid;
+			}
+		}
+		c = aa_to_linear(vec3(lab.x, lo * lab.y, lo * lab.z));
+	}
+	return vec3(aa_encode_srgb(c.x), aa_encode_srgb(c.y), aa_encode_srgb(c.z));
+}
+`
+
+// Conversions to RGB, which work the same way as the ones in image/color and
+// autoutils.
+var shaderColorSpaces = []string{
+	RGB: `
+vec3 aa_color(int r, int g, int b) {
+	return vec3(float(r), float(g), float(b));
+}
+`,
+	GRAYSCALE: `
+vec3 aa_color(int v) {
+	return vec3(float(v), float(v), float(v));
+}
+`,
+	CMYK: `
+vec3 aa_color(int c, int m, int y, int k) {
+	uint w = 0xffffu - uint(k) * 0x101u;
+	uint r = (0xffffu - uint(c) * 0x101u) * w / 0xffffu;
+	uint g = (0xffffu - uint(m) * 0x101u) * w / 0xffffu;
+	uint b = (0xffffu - uint(y) * 0x101u) * w / 0xffffu;
+	return vec3(float(r >> 8), float(g >> 8), float(b >> 8));
+}
+`,
+	HSV: `
+vec3 aa_color(int h, int s, int v) {
+	float V = float(v) / 256.0;
+	float S = float(s) / 256.0;
+	float C = V * S;
+	float H = float(h) / 42.0;
+	float X = C * (1.0 - abs(mod(H, 2.0) - 1.0));
+	vec3 rgb;
+	if (s == 0) {
+		rgb = vec3(0.0, 0.0, 0.0);
+	} else if (H <= 1.0) {
+		rgb = vec3(C, X, 0.0);
+	} else if (H <= 2.0) {
+		rgb = vec3(X, C, 0.0);
+	} else if (H <= 3.0) {
+		rgb = vec3(0.0, C, X);
+	} else if (H <= 4.0) {
+		rgb = vec3(0.0, X, C);
+	} else if (H <= 5.0) {
+		rgb = vec3(X, 0.0, C);
+	} else {
+		rgb = vec3(C, 0.0, X);
+	}
+	float m = V - C;
+	return vec3(float(int((rgb.x + m) * 255.0)), float(int((rgb.y + m) * 255.0)), float(int((rgb.z + m) * 255.0)));
+}
+`,
+	YCbCr: `
+vec3 aa_color(int y, int cb, int cr) {
+	int yy1 = y * 0x10101;
+	cb -= 128;
+	cr -= 128;
+	int r = clamp(yy1 + 91881 * cr, 0, 0xffffff) >> 16;
+	int g = clamp(yy1 - 22554 * cb - 46802 * cr, 0, 0xffffff) >> 16;
+	int b = clamp(yy1 + 116130 * cb, 0, 0xffffff) >> 16;
+	return vec3(float(r), float(g), float(b));
+}
+`,
+	HSL: `
+vec3 aa_color(int h, int s, int l) {
+	float L = float(l) / 255.0;
+	float S = float(s) / 255.0;
+	float C = (1.0 - abs(2.0 * L - 1.0)) * S;
+	float H = float(h) / 42.0;
+	float X = C * (1.0 - abs(mod(H, 2.0) - 1.0));
+	vec3 rgb;
+	if (H <= 1.0) {
+		rgb = vec3(C, X, 0.0);
+	} else if (H <= 2.0) {
+		rgb = vec3(X, C, 0.0);
+	} else if (H <= 3.0) {
+		rgb = vec3(0.0, C, X);
+	} else if (H <= 4.0) {
+		rgb = vec3(0.0, X, C);
+	} else if (H <= 5.0) {
+		rgb = vec3(X, 0.0, C);
+	} else {
+		rgb = vec3(C, 0.0, X);
+	}
+	float m = L - C / 2.0;
+	return vec3(floor((rgb.x + m) * 255.0 + 0.5), floor((rgb.y + m) * 255.0 + 0.5), floor((rgb.z + m) * 255.0 + 0.5));
+}
+`,
+	CIELAB: shaderCIELAB + shaderGamutMap + `
+vec3 aa_color(int l, int a, int b) {
+	return aa_gamut_map(vec3(float(l) * 100.0 / 255.0, float(a) - 128.0, float(b) - 128.0));
+}
+`,
+	OKLab: shaderOKLab + shaderGamutMap + `
+vec3 aa_color(int l, int a, int b) {
+	return aa_gamut_map(vec3(float(l) / 255.0, (float(a) - 128.0) / 320.0, (float(b) - 128.0) / 320.0));
+}
+`,
+	OKLCh: shaderOKLab + shaderGamutMap + `
+vec3 aa_color(int l, int c, int h) {
+	float C = float(c) / 255.0 * 0.4;
+	float angle = float(h) / 256.0 * 6.28318530717959;
+	return aa_gamut_map(vec3(float(l) / 255.0, C * cos(angle), C * sin(angle)));
+}
+`,
+}
+
+func shaderColor(c HexColor) string {
+	return fmt.Sprintf("vec4(%d.0, %d.0, %d.0, %d.0)", c.R, c.G, c.B, c.A)
+}
+
+/*
+Writes g as a GLSL fragment shader. t is iTime + time. If shadertoy is true,
+the shader is written so that it can be pasted into Shadertoy, without the
+version, precision, uniforms, or main function. With the NORMALIZE and
+PERCENTILE rectifiers, the ranges of the functions are the ones of a width by
+height image at the given time, and don't change with iTime or the resolution.
+*/
+func (g *Genome) WriteShader(w io.Writer, width int, height int, time float64, shadertoy bool) error {
+	m := g.pixelMap()
+	cs, ok := m.sys.(ShaderCoordinateSystem)
+	if !ok {
+		return fmt.Errorf("coordinate system %s can't be written as a shader", CoordinateSysNames[g.coordinateSys()])
+	}
+	declarations, expressions := autoutils.GLSL(g.Functions, append(cs.GLSLVarNames()[:2:2], "t"))
+	var b strings.Builder
+	if shadertoy {
+		b.WriteString(shadertoyHeader)
+	} else {
+		b.WriteString(shaderHeader)
+	}
+	b.WriteString("\n" + declarations)
+	rectifiers := g.Config.rectifiers(len(g.Functions))
+	if !g.Paletted {
+		// One function for each rectifier which is used
+		for r, body := range shaderRectifiers {
+			for _, used := range rectifiers {
+				if used == r {
+					fmt.Fprintf(&b, "\nfloat aa_rectify_%s(float x) {\n\treturn %s;\n}\n", RectifierNames[r], body)
+					break
+				}
+			}
+		}
+		b.WriteString(shaderByte)
+		b.WriteString(shaderColorSpaces[g.Config.ColorSpace])
+	}
+
+	b.WriteString(`
+void mainImage(out vec4 fragColor, in vec2 fragCoord) {
+	// Pixels are counted from the top left, like in images
+	float px = floor(fragCoord.x);
+	float py = iResolution.y - 1.0 - floor(fragCoord.y);
+	float aa_width = iResolution.x;
+	float aa_height = iResolution.y;
+`)
+	if m.viewport != nil {
+		b.WriteString(m.viewport.glsl())
+	}
+	b.WriteString(cs.GLSL())
+	fmt.Fprintf(&b, "\tfloat t = iTime + %s;\n", autoutils.GLSLFloat(time))
+
+	if g.Paletted {
+		b.WriteString("\tvec4 color;\n\t")
+		for i, c := range g.Palette[:len(g.Palette)-1] {
+			fmt.Fprintf(&b, "if (%s < 0.0) {\n\t\tcolor = %s;\n\t} else ", expressions[i], shaderColor(HexColor(c)))
+		}
+		// The last color is the background color
+		fmt.Fprintf(&b, "{\n\t\tcolor = %s;\n\t}\n", shaderColor(HexColor(g.Palette[len(g.Palette)-1])))
+		b.WriteString("\tfragColor = color / 255.0;\n")
+	} else {
+		channels := make([]string, len(expressions))
+		ranges := rectifierRanges(g.Functions, rectifiers, m, width, height,
+			autoutils.Interval{Min: time, Max: time})
+		for i, expression := range expressions {
+			if rectifiers[i] == NORMALIZE || rectifiers[i] == PERCENTILE {
+				expression = shaderNormalize(expression, ranges[i])
+			}
+			channels[i] = fmt.Sprintf("c%d", i)
+			fmt.Fprintf(&b, "\tint c%d = aa_byte(aa_rectify_%s(%s));\n", i, RectifierNames[rectifiers[i]], expression)
+		}
+		alpha := "255.0"
+		if g.Config.Alpha {
+			alpha = fmt.Sprintf("float(%s)", channels[len(channels)-1])
+			channels = channels[:len(channels)-1]
+		}
+		fmt.Fprintf(&b, "\tfragColor = vec4(aa_color(%s), %s) / 255.0;\n", strings.Join(channels, ", "), alpha)
+	}
+	b.WriteString("}\n")
+	if !shadertoy {
+		b.WriteString(shaderFooter)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
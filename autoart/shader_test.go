@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"image"
+	"math"
+	"strings"
+	"testing"
+)
+
+// Renders g's shader with the GLSL interpreter, the way a GPU would render it
+// at the given size with iTime = 0.
+func renderShader(t *testing.T, g *Genome, width int, height int, time float64) []uint8 {
+	var b strings.Builder
+	if err := g.WriteShader(&b, width, height, time, false); err != nil {
+		t.Fatal(err)
+	}
+	prog := compileGLSL(b.String())
+	prog.globals[prog.globalNames["iResolution"].slot] = glslVector([]float64{float64(width), float64(height), 1})
+	mainImage := prog.functions["mainImage"]
+	pix := make([]uint8, 4*width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			// Shaders count pixels from the bottom left.
+			fragCoord := glslVector([]float64{float64(x) + 0.5, float64(height-1-y) + 0.5})
+			_, params := mainImage.callWithParams([]glslValue{{kind: glslVec, size: 4}, fragCoord})
+			for i, c := range params[0].v {
+				pix[4*(y*width+x)+i] = uint8(math.Round(255 * math.Max(0, math.Min(1, c))))
+			}
+		}
+	}
+	return pix
+}
+
+// Returns the fraction of the pixels of a and b which differ by more than 2 in
+// any channel.
+func pixelsDiffering(a []uint8, b []uint8) float64 {
+	differing := 0
+	for i := 0; i < len(a); i += 4 {
+		for j := i; j < i+4; j++ {
+			if d := int(a[j]) - int(b[j]); d > 2 || d < -2 {
+				differing++
+				break
+			}
+		}
+	}
+	return float64(differing) / float64(len(a)/4)
+}
+
+func TestShaderMatchesImage(t *testing.T) {
+	const width, height, time = 24, 16, 1.25
+	noise := autoutils.NewGrammar()
+	err := noise.SetOperators("perlin1,perlin2,perlin3,simplex2,simplex3,value1,value2,value3," +
+		"worley2,worley3,select,smoothstep,+,*,sin,mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 48; i++ {
+		config := Config{
+			FunctionLength: 30,
+			ColorSpace:     i % len(ColorSpaceNames),
+			CoordinateSys:  i % (CENTERED + 1),
+			Rectifier:      i % len(RectifierNames),
+			Alpha:          i%5 == 0,
+		}
+		if i%3 == 0 {
+			config.Grammar = noise
+		}
+		if i%4 == 1 {
+			config.Viewport = &Viewport{CenterX: 0.4, CenterY: 0.6, Scale: 1.5, Rotation: 25, PreserveAspect: i%8 == 1}
+		}
+		pconfig := PaletteConfig{NColors: 4, FunctionLength: 30, CoordinateSys: config.CoordinateSys,
+			Grammar: config.Grammar, Viewport: config.Viewport}
+		g := RandomGenome(3, i%6 == 5, config, pconfig, autoutils.ItemRand(2, int64(i)))
+		name := fmt.Sprintf("genome %d (paletted %v, %s, %s, %s)", i, g.Paletted, ColorSpaceNames[config.ColorSpace],
+			RectifierNames[config.Rectifier], CoordinateSysNames[config.CoordinateSys])
+		cpu := g.Image(width, height, time).(*image.RGBA).Pix
+		gpu := renderShader(t, g, width, height, time)
+		// 32-bit constants in the shader can change a few pixels.
+		if d := pixelsDiffering(cpu, gpu); d > 0.05 {
+			t.Errorf("%s: %.0f%% of the pixels of the shader are different", name, 100*d)
+		}
+	}
+}
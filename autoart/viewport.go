@@ -0,0 +1,205 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+/*
+Viewports
+
+Normally, an image shows the whole of its coordinate system's canvas: with XY
+coordinates, x and y go from 0 to 1 across the image, so on an image which
+isn't square, everything is stretched. A Viewport shows a different part of the
+canvas instead, which can be smaller (to zoom in on some detail), bigger, off to
+the side, or turned around. With PreserveAspect, the canvas is as wide as it is
+tall, so nothing is stretched.
+
+The ranges used by the NORMALIZE rectifier are worked out for the whole canvas.
+If the view goes outside of it, they are estimated from a sample of the
+coordinates of the view, so they might be a little off.
+*/
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"math"
+)
+
+type Viewport struct {
+	// The point of the canvas at the center of the view, from (0, 0) at its
+	// top left to (1, 1) at its bottom right
+	CenterX float64 `json:"centerX"`
+	CenterY float64 `json:"centerY"`
+	// How many times bigger everything is than on the canvas (more than 1
+	// zooms in)
+	Scale float64 `json:"scale"`
+	// How far the view is turned clockwise, in degrees
+	Rotation float64 `json:"rotation"`
+	// If true, the canvas is a square as big as the longer side of the image,
+	// and the image shows the middle of it (with no other changes).
+	PreserveAspect bool `json:"preserveAspect"`
+}
+
+// The number of points on each side of the grid used by sampledDomain
+const viewportSamples = 256
+
+func (v *Viewport) UnmarshalJSON(data []byte) error {
+	// The fields which are left out are the same as in DefaultViewport.
+	type viewport Viewport // Without this method
+	w := viewport(*DefaultViewport())
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&w); err != nil {
+		return err
+	}
+	*v = Viewport(w)
+	return nil
+}
+
+// Returns a viewport which shows the whole canvas.
+func DefaultViewport() *Viewport {
+	return &Viewport{CenterX: 0.5, CenterY: 0.5, Scale: 1}
+}
+
+func (v *Viewport) Validate() error {
+	for _, x := range []float64{v.CenterX, v.CenterY, v.Rotation} {
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return fmt.Errorf("viewport center and rotation should be numbers, not %v", x)
+		}
+	}
+	if !(v.Scale > 0) || math.IsInf(v.Scale, 0) {
+		return fmt.Errorf("viewport scale should be positive, not %v", v.Scale)
+	}
+	return nil
+}
+
+// Returns the size of the canvas of a width by height image.
+func (v *Viewport) canvas(width int, height int) (int, int) {
+	if !v.PreserveAspect {
+		return width, height
+	}
+	if width > height {
+		return width, width
+	}
+	return height, height
+}
+
+// Returns the sine and cosine of the rotation. They are exact for multiples of
+// 90 degrees, so that the x of the canvas doesn't depend on the y of the pixel
+// at all when the view is upside down (see pixelMap.separable).
+func (v *Viewport) sincos() (float64, float64) {
+	switch math.Mod(v.Rotation, 360) {
+	case 0:
+		return 0, 1
+	case 90, -270:
+		return 1, 0
+	case 180, -180:
+		return 0, -1
+	case 270, -90:
+		return -1, 0
+	}
+	return math.Sincos(v.Rotation * math.Pi / 180)
+}
+
+// Returns the point of the canvas shown at the pixel (x, y) of a width by height
+// image, and the size of the canvas.
+func (v *Viewport) transform(x float64, y float64, width int, height int) (float64, float64, int, int) {
+	cwidth, cheight := v.canvas(width, height)
+	// The position relative to the center of the image, as a fraction of the
+	// canvas
+	fx := (x - float64(width)/2) / float64(cwidth)
+	fy := (y - float64(height)/2) / float64(cheight)
+	sin, cos := v.sincos()
+	return float64(cwidth) * (v.CenterX + (cos*fx+sin*fy)/v.Scale),
+		float64(cheight) * (v.CenterY + (cos*fy-sin*fx)/v.Scale), cwidth, cheight
+}
+
+// Returns the derivatives of the point transform returns: its x with respect
+// to the pixel's x and y, then its y.
+func (v *Viewport) matrix(width int, height int) (float64, float64, float64, float64) {
+	cwidth, cheight := v.canvas(width, height)
+	aspect := float64(cwidth) / float64(cheight)
+	sin, cos := v.sincos()
+	return cos / v.Scale, aspect * sin / v.Scale, -sin / (aspect * v.Scale), cos / v.Scale
+}
+
+// Returns whether every point of the view is on the canvas, for any size of
+// image.
+func (v *Viewport) onCanvas() bool {
+	const e = 1e-9
+	sin, cos := v.sincos()
+	for _, fx := range []float64{-0.5, 0.5} {
+		for _, fy := range []float64{-0.5, 0.5} {
+			x := v.CenterX + (cos*fx+sin*fy)/v.Scale
+			y := v.CenterY + (cos*fy-sin*fx)/v.Scale
+			if x < -e || x > 1+e || y < -e || y > 1+e {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Estimates the domain of cs over the view from the coordinates of a grid of
+// points on a square image (which sees at least as much of the canvas as any
+// other shape). The intervals are widened a little, since there are points
+// between the ones sampled.
+func (v *Viewport) sampledDomain(cs CoordinateSystem) []autoutils.Interval {
+	const size = viewportSamples
+	inf := math.Inf(1)
+	domain := []autoutils.Interval{{Min: inf, Max: -inf}, {Min: inf, Max: -inf}}
+	for i := 0; i <= size; i++ {
+		for j := 0; j <= size; j++ {
+			x, y, cwidth, cheight := v.transform(float64(i), float64(j), size, size)
+			v0, v1 := cs.Coordinates(x, y, cwidth, cheight)
+			for k, value := range []float64{v0, v1} {
+				if math.IsNaN(value) {
+					domain[k] = autoutils.Interval{Min: -inf, Max: inf}
+					continue
+				}
+				domain[k].Min = math.Min(domain[k].Min, value)
+				domain[k].Max = math.Max(domain[k].Max, value)
+			}
+		}
+	}
+	for k := range domain {
+		margin := (domain[k].Max - domain[k].Min) / size
+		domain[k].Min -= margin
+		domain[k].Max += margin
+	}
+	return domain
+}
+
+// Returns GLSL statements which move the pixel (px, py) to the point of the
+// canvas shown there, and set aa_width and aa_height to the size of the canvas,
+// like transform.
+func (v *Viewport) glsl() string {
+	var code string
+	if v.PreserveAspect {
+		code = "\taa_width = max(iResolution.x, iResolution.y);\n\taa_height = aa_width;\n"
+	}
+	sin, cos := v.sincos()
+	return code + fmt.Sprintf(`	float aa_fx = (px - iResolution.x / 2.0) / aa_width;
+	float aa_fy = (py - iResolution.y / 2.0) / aa_height;
+	px = aa_width * (%s + %s * aa_fx + %s * aa_fy);
+	py = aa_height * (%s + %s * aa_fy - %s * aa_fx);
+`, autoutils.GLSLFloat(v.CenterX), autoutils.GLSLFloat(cos/v.Scale), autoutils.GLSLFloat(sin/v.Scale),
+		autoutils.GLSLFloat(v.CenterY), autoutils.GLSLFloat(cos/v.Scale), autoutils.GLSLFloat(sin/v.Scale))
+}
@@ -0,0 +1,39 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoart
+
+import (
+	"fmt"
+	"github.com/pommicket/autoart/autoutils"
+	"testing"
+)
+
+func TestViewportRotationHoisting(t *testing.T) {
+	for _, rotation := range []float64{0, 90, 180, 270, 360, -180} {
+		for _, cs := range []int{XY, CENTERED} {
+			for seed := int64(0); seed < 4; seed++ {
+				viewport := &Viewport{CenterX: 0.3, CenterY: 0.7, Scale: 1.37, Rotation: rotation}
+				config := Config{FunctionLength: 40, CoordinateSys: cs, Viewport: viewport}
+				g := RandomGenome(3, false, config, PaletteConfig{}, autoutils.ItemRand(seed, 0))
+				checkHoisting(t, fmt.Sprintf("rotation %v, coordinates %d, seed %d", rotation, cs, seed), g, 64, 36)
+			}
+		}
+	}
+}
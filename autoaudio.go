@@ -24,31 +24,48 @@ import (
 	"fmt"
 	"github.com/pommicket/autoart/autoart"
 	"github.com/pommicket/autoart/autoutils"
-	"math/rand"
 	"os"
 	"time"
 )
 
-func generateAudio(seed int64, length int64, sampleRate int64, functionLength int64, number int64) error {
-	rand.Seed(seed)
-	dir := fmt.Sprintf("autoaudio%v", seed)
+// Generates item n of the batch with the given seed, and saves it, along with
+// its manifest.
+func genAudio(length int64, sampleRate int64, functionLength int64, rectifier int, seed int64, n int64, filename string) error {
+	var function autoutils.Function
+	function.Generate(1, int(functionLength), autoutils.ItemRand(seed, n))
+	return saveAudio(&function, float64(length), sampleRate, functionLength, rectifier, seed, n, filename)
+}
+
+// Makes audio from function, and saves it with its manifest embedded and next
+// to it.
+func saveAudio(function *autoutils.Function, length float64, sampleRate int64, functionLength int64, rectifier int, seed int64, n int64, filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	manifest := autoart.NewAudioManifest(seed, n, length, int(sampleRate), int(functionLength), rectifier, function)
+	err = autoart.GenerateAudioFromFunction(file, length, int32(sampleRate), function, rectifier, manifest)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return manifest.Save(manifestFilename(filename))
+}
+
+// Generates items first to first+number-1 of the batch with the given seed,
+// and puts them in dir.
+func generateAudio(dir string, seed int64, first int64, number int64, length int64, sampleRate int64, functionLength int64, rectifier int) error {
 	err := os.MkdirAll(dir, 0700)
 	if err != nil {
 		return err
 	}
 	err = autoutils.RunInBatches(number, "Generating audio...", func(n int64, errs chan<- error) {
+		n += first
 		filename := fmt.Sprintf("%v/%09d.wav", dir, n)
-		file, err := os.Create(filename)
-		if err != nil {
-			errs <- err
-			return
-		}
-		err = autoart.GenerateAudio(file, float64(length), int32(sampleRate), int(functionLength), autoart.MOD)
-		if err != nil {
-			errs <- err
-			return
-		}
-		errs <- file.Close()
+		errs <- genAudio(length, sampleRate, functionLength, rectifier, seed, n, filename)
 	})
 	if err != nil {
 		return err
@@ -72,12 +89,7 @@ Please enter 1, 2, or 3 (default: 1): `
 	t := time.Now().UTC().UnixNano()
 	if option == 1 {
 		filename := fmt.Sprintf("autoaudio%v.wav", t)
-		rand.Seed(t)
-		file, err := os.Create(filename)
-		if err != nil {
-			return err
-		}
-		err = autoart.GenerateAudio(file, 60, 44100, 80, autoart.MOD)
+		err := genAudio(60, 44100, 80, autoart.MOD, t, 0, filename)
 		if err != nil {
 			return err
 		}
@@ -94,7 +106,7 @@ Please enter 1, 2, or 3 (default: 1): `
 		return err
 	}
 	if option == 2 {
-		return generateAudio(t, length, 44100, 80, number)
+		return generateAudio(fmt.Sprintf("autoaudio%v", t), t, 0, number, length, 44100, 80, autoart.MOD)
 	}
 	sampleRate, err := readInt64(reader, "Sample rate (default: 44100)? ", positive, 44100)
 	if err != nil {
@@ -108,6 +120,6 @@ Please enter 1, 2, or 3 (default: 1): `
 	if err != nil {
 		return err
 	}
-	return generateAudio(seed, length, sampleRate, functionLength, number)
+	return generateAudio(fmt.Sprintf("autoaudio%v", seed), seed, 0, number, length, sampleRate, functionLength, autoart.MOD)
 
 }
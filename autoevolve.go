@@ -0,0 +1,274 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+// AutoEvolve client: the user picks the images they like, and the next
+// generation is bred from them.
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/pommicket/autoart/autoart"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	evolveColumns = 3
+	// Size of each candidate in the terminal preview. Each character shows
+	// two pixels, one above the other.
+	terminalPreviewWidth  = 40
+	terminalPreviewHeight = 24
+	// Size of each candidate in the contact sheet
+	sheetPreviewWidth  = 320
+	sheetPreviewHeight = 180
+	sheetGap           = 8
+)
+
+func renderCandidates(population []*autoart.Genome, width int, height int) []image.Image {
+	imgs := make([]image.Image, len(population))
+	for i, g := range population {
+		imgs[i] = g.Image(width, height, 0)
+	}
+	return imgs
+}
+
+// Prints the images in a grid using 24-bit ANSI colors.
+func showInTerminal(imgs []image.Image) {
+	for first := 0; first < len(imgs); first += evolveColumns {
+		last := first + evolveColumns
+		if last > len(imgs) {
+			last = len(imgs)
+		}
+		for i := first; i < last; i++ {
+			fmt.Printf("%-*d ", terminalPreviewWidth, i+1)
+		}
+		fmt.Println()
+		for y := 0; y < terminalPreviewHeight; y += 2 {
+			for i := first; i < last; i++ {
+				for x := 0; x < terminalPreviewWidth; x++ {
+					top := color.RGBAModel.Convert(imgs[i].At(x, y)).(color.RGBA)
+					bottom := color.RGBAModel.Convert(imgs[i].At(x, y+1)).(color.RGBA)
+					fmt.Printf("\x1b[38;2;%d;%d;%dm\x1b[48;2;%d;%d;%dm▀",
+						top.R, top.G, top.B, bottom.R, bottom.G, bottom.B)
+				}
+				fmt.Print("\x1b[0m ")
+			}
+			fmt.Println()
+		}
+	}
+}
+
+// Puts the images in a grid, and saves it as a PNG.
+func saveContactSheet(imgs []image.Image, filename string) error {
+	rows := (len(imgs) + evolveColumns - 1) / evolveColumns
+	sheet := image.NewRGBA(image.Rect(0, 0,
+		evolveColumns*(sheetPreviewWidth+sheetGap)+sheetGap,
+		rows*(sheetPreviewHeight+sheetGap)+sheetGap))
+	draw.Draw(sheet, sheet.Bounds(), image.White, image.Point{}, draw.Src)
+	for i, img := range imgs {
+		x := sheetGap + (i%evolveColumns)*(sheetPreviewWidth+sheetGap)
+		y := sheetGap + (i/evolveColumns)*(sheetPreviewHeight+sheetGap)
+		r := image.Rect(x, y, x+sheetPreviewWidth, y+sheetPreviewHeight)
+		draw.Draw(sheet, r, img, image.Point{}, draw.Over)
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = png.Encode(file, sheet)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Reads a list of candidate numbers from 1 to n. An empty list is allowed.
+// If the user enters q, nil is returned.
+func readChoices(reader *bufio.Reader, prompt string, n int) ([]int, error) {
+	for {
+		fmt.Print(prompt)
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if strings.ToLower(line) == "q" {
+			return nil, nil
+		}
+		choices := []int{}
+		valid := true
+		for _, field := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ' ' || r == ','
+		}) {
+			i, err := strconv.Atoi(field)
+			if err != nil || i < 1 || i > n {
+				valid = false
+				break
+			}
+			choices = append(choices, i-1)
+		}
+		if valid {
+			return choices, nil
+		}
+		fmt.Printf("Please enter numbers between 1 and %d.\n", n)
+	}
+}
+
+// Makes the next generation from the chosen parents. The parents are kept,
+// and the rest of the generation are their (mutated) children.
+func nextGeneration(rng *rand.Rand, parents []*autoart.Genome, size int) []*autoart.Genome {
+	population := make([]*autoart.Genome, size)
+	copy(population, parents)
+	for i := len(parents); i < size; i++ {
+		child := new(autoart.Genome)
+		child.Breed(parents[rng.Intn(len(parents))], parents[rng.Intn(len(parents))], rng)
+		child.Mutate(rng)
+		population[i] = child
+	}
+	return population
+}
+
+func autoEvolve(reader *bufio.Reader) error {
+	positive := func(i int64) bool { return i > 0 }
+	size, err := readInt64(reader, "How many candidates per generation (default: 9)? ", positive, 9)
+	if err != nil {
+		return err
+	}
+	display, err := readInt64(reader, `How should the candidates be shown?
+1. In the terminal (needs a terminal with 24-bit color)
+2. As an image (autoevolve.png)
+Please enter 1 or 2 (default: 1): `, func(i int64) bool {
+		return i >= 1 && i <= 2
+	}, 1)
+	if err != nil {
+		return err
+	}
+	var conf autoart.Config
+	var pconf autoart.PaletteConfig
+	paletted, err := readOptions(reader, &conf, &pconf)
+	if err != nil {
+		return err
+	}
+	t := time.Now().UTC().UnixNano()
+	seed, err := readInt64(reader, "Random seed (default: current time)? ", func(i int64) bool {
+		return true
+	}, t)
+	if err != nil {
+		return err
+	}
+	rng := rand.New(rand.NewSource(seed))
+
+	randomGeneration := func() []*autoart.Genome {
+		population := make([]*autoart.Genome, size)
+		for i := range population {
+			population[i] = autoart.RandomGenome(3, paletted, conf, pconf, rng)
+		}
+		return population
+	}
+	population := randomGeneration()
+	for generation := 1; ; generation++ {
+		fmt.Println("Generation", generation)
+		if display == 1 {
+			showInTerminal(renderCandidates(population, terminalPreviewWidth, terminalPreviewHeight))
+		} else {
+			imgs := renderCandidates(population, sheetPreviewWidth, sheetPreviewHeight)
+			if err = saveContactSheet(imgs, "autoevolve.png"); err != nil {
+				return err
+			}
+			fmt.Println("The candidates are in autoevolve.png, numbered from left to right, top to bottom.")
+		}
+		parents, err := readChoices(reader, `Which ones do you like? Enter their numbers (e.g. 1 4 7),
+nothing to start over with new random ones, or q if you're done: `, len(population))
+		if err != nil {
+			return err
+		}
+		if parents == nil {
+			break
+		}
+		if len(parents) == 0 {
+			population = randomGeneration()
+			continue
+		}
+		chosen := make([]*autoart.Genome, len(parents))
+		for i, p := range parents {
+			chosen[i] = population[p]
+		}
+		population = nextGeneration(rng, chosen, len(population))
+	}
+
+	choice, err := readInt64(reader, "Which one do you want to keep (default: 1)? ", func(i int64) bool {
+		return i >= 1 && i <= int64(len(population))
+	}, 1)
+	if err != nil {
+		return err
+	}
+	genome := population[choice-1]
+	for _, formula := range genome.Formulas(false, 4) {
+		fmt.Println(formula)
+	}
+	kind, err := readInt64(reader, `What do you want to make with it?
+1. An image
+2. A video
+Please enter 1 or 2 (default: 1): `, func(i int64) bool {
+		return i >= 1 && i <= 2
+	}, 1)
+	if err != nil {
+		return err
+	}
+	width, err := readInt64(reader, "Width (default: 1920)? ", positive, 1920)
+	if err != nil {
+		return err
+	}
+	height, err := readInt64(reader, "Height (default: 1080)? ", positive, 1080)
+	if err != nil {
+		return err
+	}
+	if kind == 1 {
+		filename := fmt.Sprintf("autoevolve%v.png", seed)
+		if err = saveImage(genome, int(width), int(height), 0, nil, seed, 0, filename); err != nil {
+			return err
+		}
+		fmt.Println("Generated an image:", filename)
+		return nil
+	}
+	length, err := readInt64(reader, "Length in seconds (default: 10)? ", positive, 10)
+	if err != nil {
+		return err
+	}
+	framerate, err := readInt64(reader, "Frame rate (default: 24)? ", positive, 24)
+	if err != nil {
+		return err
+	}
+	filename := fmt.Sprintf("autoevolve%v.mp4", seed)
+	if err = saveVideo(genome, int(width), int(height), float64(length), int(framerate), seed, 0, filename); err != nil {
+		return err
+	}
+	fmt.Println("Generated video:", filename)
+	return nil
+}
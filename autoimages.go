@@ -25,44 +25,77 @@ import (
 	"github.com/pommicket/autoart/autoart"
 	"github.com/pommicket/autoart/autoutils"
 	"image"
-	"image/png"
-	"math/rand"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
 // AutoImages client
 
-func genImage(width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, filename string) error {
+// Returns the name of the manifest for the file filename.
+func manifestFilename(filename string) string {
+	return strings.TrimSuffix(filename, filepath.Ext(filename)) + ".json"
+}
+
+// Generates item n of the batch with the given seed, and saves it, along with
+// its manifest.
+func genImage(width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, filter *autoart.QualityFilter, relief *autoart.Relief, seed int64, n int64, filename string) error {
+	rng := autoutils.ItemRand(seed, n)
+	var genome *autoart.Genome
+	if filter != nil {
+		genome = filter.RandomGenome(2, paletted, *conf, *pconf, rng)
+	} else {
+		genome = autoart.RandomGenome(2, paletted, *conf, *pconf, rng)
+	}
+	return saveImage(genome, width, height, 0, relief, seed, n, filename)
+}
+
+// Renders genome at the given time (as a relief, if relief isn't nil), and
+// saves it with its manifest embedded and next to it.
+func saveImage(genome *autoart.Genome, width int, height int, time float64, relief *autoart.Relief, seed int64, n int64, filename string) error {
 	var img image.Image
-	if paletted {
-		img = autoart.GenerateImagePalette(width, height, *pconf)
+	if relief != nil {
+		var err error
+		if img, err = genome.ReliefImage(width, height, time, relief); err != nil {
+			return err
+		}
 	} else {
-		img = autoart.GenerateImage(width, height, *conf)
+		img = genome.Image(width, height, time)
 	}
 	file, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
-	err = png.Encode(file, img)
+	if unbounded := genome.Unbounded(time); len(unbounded) > 0 {
+		fmt.Printf("Warning: %s: functions %v have unbounded ranges, so they use sigmoid instead of being normalized.\n", filename, unbounded)
+	}
+	manifest := autoart.NewImageManifest(seed, n, width, height, genome)
+	manifest.Time = time
+	manifest.Relief = relief
+	err = autoart.EncodePNG(file, img, manifest)
 	if err != nil {
 		file.Close()
 		return err
 	}
-	return file.Close()
+	if err = file.Close(); err != nil {
+		return err
+	}
+	return manifest.Save(manifestFilename(filename))
 }
 
-func batchedImages(seed int64, width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, number int64) error {
+// Generates items first to first+number-1 of the batch with the given seed,
+// and puts them in dir.
+func batchedImages(dir string, seed int64, first int64, number int64, width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, filter *autoart.QualityFilter, relief *autoart.Relief) error {
 	// Create a directory for the images
-	rand.Seed(seed)
-	dir := fmt.Sprintf("autoimages%v", seed)
 	err := os.MkdirAll(dir, 0700)
 	if err != nil {
 		return err
 	}
 	err = autoutils.RunInBatches(number, "Generating images...", func(n int64, errs chan<- error) {
+		n += first
 		filename := fmt.Sprintf("%v/%09d.png", dir, n)
-		errs <- genImage(width, height, paletted, conf, pconf, filename)
+		errs <- genImage(width, height, paletted, conf, pconf, filter, relief, seed, n, filename)
 	})
 
 	if err != nil {
@@ -88,10 +121,9 @@ Please enter 1, 2, or 3 (default: 1): `
 	var pconf autoart.PaletteConfig
 	t := time.Now().UTC().UnixNano()
 	if option == 1 {
-		rand.Seed(t)
 		fmt.Println("Generating image...")
 		filename := fmt.Sprintf("autoimages%d.png", t)
-		err = genImage(1920, 1080, false, &conf, &pconf, filename)
+		err = genImage(1920, 1080, false, &conf, &pconf, nil, nil, t, 0, filename)
 		if err != nil {
 			// We're done!
 			fmt.Println("Generated an image:", filename)
@@ -113,29 +145,25 @@ Please enter 1, 2, or 3 (default: 1): `
 		return err
 	}
 	if option == 2 {
-		return batchedImages(t, int(width), int(height), false, &conf, &pconf, number)
+		return batchedImages(fmt.Sprintf("autoimages%v", t), t, 0, number, int(width), int(height), false, &conf, &pconf, nil, nil)
 	}
 
-	paletted, err := readBool(reader, "Should a palette be used (y/n, default: n)? ", false)
+	// Advanced options
+	paletted, err := readOptions(reader, &conf, &pconf)
 	if err != nil {
 		return err
 	}
-
-	// Advanced options
-	if paletted {
-		err = readPaletteConf(reader, &pconf)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = readConf(reader, &conf)
-		if err != nil {
-			return err
-		}
+	var filter *autoart.QualityFilter
+	reject, err := readBool(reader, "Should boring images (flat colors, gradients, noise) be thrown out (y/n, default: n)? ", false)
+	if err != nil {
+		return err
+	}
+	if reject {
+		filter = autoart.DefaultQualityFilter()
 	}
 	seed, err := readInt64(reader, "Random seed (default: current time)? ", func(i int64) bool {
 		return true
 	}, t)
 
-	return batchedImages(seed, int(width), int(height), paletted, &conf, &pconf, number)
+	return batchedImages(fmt.Sprintf("autoimages%v", seed), seed, 0, number, int(width), int(height), paletted, &conf, &pconf, filter, nil)
 }
@@ -20,13 +20,40 @@ along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
 package autoutils
 
 import (
+	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
+	"io/ioutil"
 )
 
+// An entry of a WAV file's LIST INFO chunk. ID is a four character code, such
+// as "ICMT" for a comment or "ISFT" for the software which made the file.
+type InfoEntry struct {
+	ID   string
+	Text string
+}
+
+// Returns the size of the LIST chunk holding info (not counting its header).
+func infoListSize(info []InfoEntry) uint32 {
+	size := uint32(4) // "INFO"
+	for _, entry := range info {
+		// Text is null-terminated, and padded to an even length
+		textSize := uint32(len(entry.Text)) + 1
+		size += 8 + textSize + textSize%2
+	}
+	return size
+}
+
 // Write a header to writer. You need to decide ahead of time how many samples
 // you want.
 func WriteAudioHeader(writer io.Writer, nSamples int64, channels, sampleRate int32) error {
+	return WriteAudioHeaderInfo(writer, nSamples, channels, sampleRate, nil)
+}
+
+// Like WriteAudioHeader, but also writes a LIST INFO chunk with the given
+// entries (unless there aren't any).
+func WriteAudioHeaderInfo(writer io.Writer, nSamples int64, channels, sampleRate int32, info []InfoEntry) error {
 	w := func(data interface{}) error {
 		return binary.Write(writer, binary.LittleEndian, data)
 	}
@@ -35,6 +62,9 @@ func WriteAudioHeader(writer io.Writer, nSamples int64, channels, sampleRate int
 		return err
 	}
 	var chunkSize1 uint32 = 36 + uint32(nSamples)
+	if len(info) > 0 {
+		chunkSize1 += 8 + infoListSize(info)
+	}
 	if err = w(chunkSize1); err != nil {
 		return err
 	}
@@ -69,6 +99,35 @@ func WriteAudioHeader(writer io.Writer, nSamples int64, channels, sampleRate int
 	if err = w(bitsPerSample); err != nil {
 		return err
 	}
+	if len(info) > 0 {
+		if err = w([]byte("LIST")); err != nil {
+			return err
+		}
+		if err = w(infoListSize(info)); err != nil {
+			return err
+		}
+		if err = w([]byte("INFO")); err != nil {
+			return err
+		}
+		for _, entry := range info {
+			if len(entry.ID) != 4 {
+				return fmt.Errorf("INFO IDs should be 4 characters long: %q", entry.ID)
+			}
+			text := append([]byte(entry.Text), 0)
+			if len(text)%2 == 1 {
+				text = append(text, 0)
+			}
+			if err = w([]byte(entry.ID)); err != nil {
+				return err
+			}
+			if err = w(uint32(len(entry.Text) + 1)); err != nil {
+				return err
+			}
+			if err = w(text); err != nil {
+				return err
+			}
+		}
+	}
 	if err = w([]byte("data")); err != nil {
 		return err
 	}
@@ -104,3 +163,67 @@ func WriteAudio(writer io.Writer, audio []uint8, channels, sampleRate int32) err
 	}
 	return nil
 }
+
+// Longest LIST chunk ReadAudioInfo will read
+const maxInfoSize = 1 << 24
+
+// Reads the entries of the LIST INFO chunk of the WAV file read from r. Only
+// the chunks before the audio data are searched.
+func ReadAudioInfo(r io.Reader) ([]InfoEntry, error) {
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if string(header[:4]) != "RIFF" || string(header[8:]) != "WAVE" {
+		return nil, fmt.Errorf("not a WAV file")
+	}
+	// The rest of the file, not counting "WAVE"
+	remaining := int64(binary.LittleEndian.Uint32(header[4:8])) - 4
+	header = header[:8]
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return nil, err
+		}
+		id := string(header[:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:]))
+		if id == "data" {
+			return nil, fmt.Errorf("no INFO chunk in WAV file")
+		}
+		if 8+size > remaining {
+			return nil, fmt.Errorf("%q chunk is bigger than the WAV file", id)
+		}
+		remaining -= 8 + size + size%2
+		if id != "LIST" || size > maxInfoSize {
+			if _, err := io.CopyN(ioutil.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		list := make([]byte, size+size%2)
+		if _, err := io.ReadFull(r, list); err != nil {
+			return nil, err
+		}
+		list = list[:size]
+		if len(list) < 4 || string(list[:4]) != "INFO" {
+			continue
+		}
+		var info []InfoEntry
+		for list = list[4:]; len(list) >= 8; {
+			entrySize := int(binary.LittleEndian.Uint32(list[4:8]))
+			if 8+entrySize > len(list) {
+				return nil, fmt.Errorf("INFO entry %q is too long", list[:4])
+			}
+			text := list[8 : 8+entrySize]
+			if i := bytes.IndexByte(text, 0); i >= 0 {
+				text = text[:i]
+			}
+			info = append(info, InfoEntry{ID: string(list[:4]), Text: string(text)})
+			next := 8 + entrySize + entrySize%2
+			if next > len(list) {
+				next = len(list)
+			}
+			list = list[next:]
+		}
+		return info, nil
+	}
+}
@@ -0,0 +1,57 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestAudioInfo(t *testing.T) {
+	info := []InfoEntry{{"ICMT", "a comment"}, {"ISFT", "odd"}}
+	var buf bytes.Buffer
+	if err := WriteAudioHeaderInfo(&buf, 10, 1, 8000, info); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 10))
+	encoded := buf.Bytes()
+	read, err := ReadAudioInfo(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, info) {
+		t.Errorf("wrote %v, but read %v", info, read)
+	}
+
+	// The LIST chunk comes after the 12 byte RIFF header and the fmt chunk.
+	tooLong := append([]byte(nil), encoded...)
+	binary.LittleEndian.PutUint32(tooLong[12+24+4:], 0xfffffff0)
+	if _, err = ReadAudioInfo(bytes.NewReader(tooLong)); err == nil {
+		t.Error("read a LIST chunk which is bigger than the file")
+	}
+	tooLong = append([]byte(nil), encoded...)
+	binary.LittleEndian.PutUint32(tooLong[4:], 0xfffffff0)
+	binary.LittleEndian.PutUint32(tooLong[12+24+4:], 0xfffffff0-12-24-4)
+	if _, err = ReadAudioInfo(bytes.NewReader(tooLong)); err == nil {
+		t.Error("read a LIST chunk which is bigger than the file")
+	}
+}
@@ -21,8 +21,29 @@ package autoutils
 
 import (
 	"fmt"
+	"math/rand"
 )
 
+/*
+Returns the seed for item n of a batch generated with the given seed. Each item
+gets its own random number generator, so that the items don't depend on the
+order in which they are generated, and any item can be generated again on its
+own.
+*/
+func ItemSeed(seed int64, n int64) int64 {
+	// SplitMix64 (http://xorshift.di.unimi.it/splitmix64.c)
+	z := uint64(seed) + (uint64(n)+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return int64(z ^ (z >> 31))
+}
+
+// Returns a random number generator for item n of a batch generated with the
+// given seed.
+func ItemRand(seed int64, n int64) *rand.Rand {
+	return rand.New(rand.NewSource(ItemSeed(seed, n)))
+}
+
 /*
 This function runs f in batches of batchSize. n will be the number in the
 sequence. f should send an error to errs if it wants this function to return
@@ -56,3 +56,122 @@ func HSVToRGB(h uint8, s uint8, v uint8) (uint8, uint8, uint8) {
 	b *= 255
 	return uint8(r), uint8(g), uint8(b)
 }
+
+func HSLToRGB(h uint8, s uint8, l uint8) (uint8, uint8, uint8) {
+	// https://en.wikipedia.org/wiki/HSL_and_HSV#HSL_to_RGB
+	L := float64(l) / 255
+	S := float64(s) / 255
+	C := (1 - math.Abs(2*L-1)) * S
+	H := float64(h) / (256 / 6)
+	X := C * (1 - math.Abs(math.Mod(H, 2)-1))
+	var r, g, b float64
+	switch {
+	case H <= 1:
+		r, g, b = C, X, 0
+	case H <= 2:
+		r, g, b = X, C, 0
+	case H <= 3:
+		r, g, b = 0, C, X
+	case H <= 4:
+		r, g, b = 0, X, C
+	case H <= 5:
+		r, g, b = X, 0, C
+	default:
+		r, g, b = C, 0, X
+	}
+	m := L - C/2
+	return uint8(math.Round(255 * (r + m))), uint8(math.Round(255 * (g + m))), uint8(math.Round(255 * (b + m)))
+}
+
+// Converts a linear RGB value from 0 to 1 to an 8-bit sRGB value.
+func encodeSRGB(c float64) uint8 {
+	c = math.Max(0, math.Min(1, c))
+	if c <= 0.0031308 {
+		c *= 12.92
+	} else {
+		c = 1.055*math.Pow(c, 1/2.4) - 0.055
+	}
+	return uint8(math.Round(255 * c))
+}
+
+// Returns whether a linear RGB color is in the sRGB gamut (allowing for
+// rounding errors).
+func inGamut(r float64, g float64, b float64) bool {
+	const e = 1e-6
+	return r >= -e && r <= 1+e && g >= -e && g <= 1+e && b >= -e && b <= 1+e
+}
+
+/*
+Converts a color in a space like CIELAB (with a lightness, L, and two
+coordinates, a and b, whose distance from 0 is the chroma) to sRGB, using
+toLinear to convert it to linear RGB. If the color is outside of the sRGB
+gamut, its chroma is reduced as little as possible to bring it inside, so it
+keeps its lightness and hue (rather than clipping each of r, g, and b, which
+changes both).
+*/
+func gamutMap(L float64, a float64, b float64, toLinear func(L, a, b float64) (float64, float64, float64)) (uint8, uint8, uint8) {
+	r, g, bl := toLinear(L, a, b)
+	if !inGamut(r, g, bl) {
+		// Binary search for the most chroma in the gamut
+		lo, hi := 0.0, 1.0
+		for i := 0; i < 20; i++ {
+			mid := (lo + hi) / 2
+			if inGamut(toLinear(L, mid*a, mid*b)) {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		r, g, bl = toLinear(L, lo*a, lo*b)
+	}
+	return encodeSRGB(r), encodeSRGB(g), encodeSRGB(bl)
+}
+
+// Converts CIELAB (with a D65 white point) to linear RGB.
+func cielabToLinear(L float64, a float64, b float64) (float64, float64, float64) {
+	// https://en.wikipedia.org/wiki/CIELAB_color_space#From_CIELAB_to_CIEXYZ
+	finv := func(t float64) float64 {
+		const delta = 6.0 / 29
+		if t > delta {
+			return t * t * t
+		}
+		return 3 * delta * delta * (t - 4.0/29)
+	}
+	fy := (L + 16) / 116
+	x := 0.95047 * finv(fy+a/500)
+	y := finv(fy)
+	z := 1.08883 * finv(fy-b/200)
+	return 3.2404542*x - 1.5371385*y - 0.4985314*z,
+		-0.9692660*x + 1.8760108*y + 0.0415560*z,
+		0.0556434*x - 0.2040259*y + 1.0572252*z
+}
+
+// Converts OKLab to linear RGB.
+func oklabToLinear(L float64, a float64, b float64) (float64, float64, float64) {
+	// https://bottosson.github.io/posts/oklab/
+	l := L + 0.3963377774*a + 0.2158037573*b
+	m := L - 0.1055613458*a - 0.0638541728*b
+	s := L - 0.0894841775*a - 1.2914855480*b
+	l, m, s = l*l*l, m*m*m, s*s*s
+	return 4.0767416621*l - 3.3077115913*m + 0.2309699292*s,
+		-1.2684380046*l + 2.6097574011*m - 0.3413193965*s,
+		-0.0041960863*l - 0.7034186147*m + 1.7076147010*s
+}
+
+// Converts CIELAB to RGB. L goes from 0 to 100, and a and b from -128 to 127.
+func CIELABToRGB(l uint8, a uint8, b uint8) (uint8, uint8, uint8) {
+	return gamutMap(float64(l)*100/255, float64(a)-128, float64(b)-128, cielabToLinear)
+}
+
+// Converts OKLab to RGB. L goes from 0 to 1, and a and b from -0.4 to 0.4.
+func OKLabToRGB(l uint8, a uint8, b uint8) (uint8, uint8, uint8) {
+	return gamutMap(float64(l)/255, (float64(a)-128)/320, (float64(b)-128)/320, oklabToLinear)
+}
+
+// Converts OKLCh (OKLab with polar coordinates) to RGB. L goes from 0 to 1, C
+// from 0 to 0.4, and h all the way around.
+func OKLChToRGB(l uint8, c uint8, h uint8) (uint8, uint8, uint8) {
+	C := float64(c) / 255 * 0.4
+	angle := float64(h) / 256 * 2 * math.Pi
+	return gamutMap(float64(l)/255, C*math.Cos(angle), C*math.Sin(angle), oklabToLinear)
+}
@@ -0,0 +1,98 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Returns random functions of 3 variables for tests, with seed as their seed:
+// ones from the default grammar, and ones made mostly of noise, SELECT, and
+// SMOOTHSTEP.
+func testFunctions(t testing.TB, seed int64, n int) []Function {
+	special := NewGrammar()
+	err := special.SetOperators("perlin1,perlin2,perlin3,simplex2,simplex3,value1,value2,value3," +
+		"worley2,worley3,select,smoothstep,step,+,*,/,mod,pow,log,sqrt,atan2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rng := rand.New(rand.NewSource(seed))
+	functions := make([]Function, n)
+	for i := range functions {
+		grammar := defaultGrammar
+		if i%2 == 1 {
+			grammar = special
+		}
+		functions[i].GenerateWith(grammar, 3, 1+rng.Intn(60), rng)
+	}
+	return functions
+}
+
+// Values of variables to test functions at
+var testValues = []float64{0, math.Copysign(0, -1), 1, -1, 0.5, -2.75, 1e9, -1e300,
+	math.Inf(1), math.Inf(-1), math.NaN()}
+
+func TestCompiledFunctionBitIdentical(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i, f := range testFunctions(t, 2, 300) {
+		c := f.Compile()
+		check := func(vars []float64) {
+			want, got := f.Evaluate(vars), c.Evaluate(vars)
+			if math.Float64bits(want) != math.Float64bits(got) {
+				t.Fatalf("function %d (%v) at %v: Evaluate gives %v, but the compiled function gives %v",
+					i, f.String(), vars, want, got)
+			}
+		}
+		for _, x := range testValues {
+			for _, y := range testValues {
+				check([]float64{x, y, testValues[rng.Intn(len(testValues))]})
+			}
+		}
+		for j := 0; j < 50; j++ {
+			check([]float64{rng.NormFloat64() * 10, rng.NormFloat64(), rng.Float64()})
+		}
+	}
+}
+
+func BenchmarkFunctionEvaluate(b *testing.B) {
+	functions := testFunctions(b, 3, 16)
+	vars := []float64{0.25, 0.75, 1.5}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		functions[i%len(functions)].Evaluate(vars)
+	}
+}
+
+func BenchmarkCompiledFunctionEvaluate(b *testing.B) {
+	functions := testFunctions(b, 3, 16)
+	compiled := make([]*CompiledFunction, len(functions))
+	for i := range functions {
+		compiled[i] = functions[i].Compile()
+	}
+	vars := []float64{0.25, 0.75, 1.5}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		compiled[i%len(compiled)].Evaluate(vars)
+	}
+}
@@ -0,0 +1,220 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Derivatives
+
+Derivative differentiates a function symbolically, so its derivatives are
+exact, except where it isn't differentiable (e.g. at the jumps of floor, step,
+and mod, where the derivative is taken to be 0, the slope on either side). The
+one exception is noise: the derivative of a noise operator is worked out from
+the noise on either side of its arguments, very close together, so it is
+almost exact.
+*/
+
+import (
+	"math"
+)
+
+// The distance from the arguments of a noise operator to the points used for
+// its derivative
+const noiseDerivativeStep = 1e-4
+
+func opExpr(op int, args ...*expr) *expr {
+	return &expr{op: Operator{op: op}, args: args}
+}
+
+// The following functions build expressions for derivatives, where nil is an
+// expression which is always 0.
+
+func addExpr(a *expr, b *expr) *expr {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	return opExpr(ADD, a, b)
+}
+
+func subExpr(a *expr, b *expr) *expr {
+	switch {
+	case b == nil:
+		return a
+	case a == nil:
+		return opExpr(MUL, constExpr(-1), b)
+	}
+	return opExpr(SUB, a, b)
+}
+
+func mulExpr(a *expr, b *expr) *expr {
+	if a == nil || b == nil {
+		return nil
+	}
+	return opExpr(MUL, a, b)
+}
+
+func divExpr(a *expr, b *expr) *expr {
+	if a == nil {
+		return nil
+	}
+	return opExpr(DIV, a, b)
+}
+
+func selectExpr(condition *expr, a *expr, b *expr) *expr {
+	switch {
+	case a == nil && b == nil:
+		return nil
+	case a == nil:
+		a = constExpr(0)
+	case b == nil:
+		b = constExpr(0)
+	}
+	return opExpr(SELECT, condition, a, b)
+}
+
+// Returns the derivative of e with respect to variable v, or nil if it is
+// always 0.
+func (e *expr) derivative(v int) *expr {
+	op := e.op.op
+	switch {
+	case op == CONST:
+		return nil
+	case op >= FIRST_VAR:
+		if op-FIRST_VAR == v {
+			return constExpr(1)
+		}
+		return nil
+	}
+	a := e.args
+	d := make([]*expr, len(a))
+	for i, arg := range a {
+		d[i] = arg.derivative(v)
+	}
+	if isNoise(op) {
+		var sum *expr
+		for i := range a {
+			if d[i] == nil {
+				continue
+			}
+			shifted := func(h float64) *expr {
+				args := append([]*expr(nil), a...)
+				args[i] = opExpr(ADD, a[i], constExpr(h))
+				return opExpr(op, args...)
+			}
+			slope := opExpr(MUL, opExpr(SUB, shifted(noiseDerivativeStep), shifted(-noiseDerivativeStep)),
+				constExpr(1/(2*noiseDerivativeStep)))
+			sum = addExpr(sum, mulExpr(slope, d[i]))
+		}
+		return sum
+	}
+	switch op {
+	case ADD:
+		return addExpr(d[0], d[1])
+	case SUB:
+		return subExpr(d[0], d[1])
+	case MUL:
+		return addExpr(mulExpr(d[0], a[1]), mulExpr(a[0], d[1]))
+	case DIV:
+		// a'/b - ab'/b²
+		return subExpr(divExpr(d[0], a[1]), divExpr(mulExpr(a[0], d[1]), opExpr(MUL, a[1], a[1])))
+	case MIN:
+		return selectExpr(opExpr(SUB, a[1], a[0]), d[0], d[1])
+	case MAX:
+		return selectExpr(opExpr(SUB, a[0], a[1]), d[0], d[1])
+	case MOD:
+		// a mod b = a - b floor(a / b)
+		return subExpr(d[0], mulExpr(d[1], opExpr(FLOOR, opExpr(DIV, a[0], a[1]))))
+	case POW:
+		// pow(a, b) = |a|^b, whose derivative is |a|^b (b' log|a| + ba'/a).
+		// That is 0 * -inf if a = 0, so it's taken to be 0 there, unless b < 0,
+		// where pow(0, b) is 0.01^b, whose derivative is 0.01^b b' log 0.01.
+		zero := selectExpr(opExpr(SUB, constExpr(0), a[1]), mulExpr(e, mulExpr(d[1], constExpr(math.Log(0.01)))), nil)
+		return selectExpr(opExpr(ABS, a[0]),
+			mulExpr(e, addExpr(mulExpr(d[1], opExpr(LOG, a[0])), mulExpr(a[1], divExpr(d[0], a[0])))), zero)
+	case ATAN2:
+		// (ba' - ab') / (a² + b²)
+		return divExpr(subExpr(mulExpr(a[1], d[0]), mulExpr(a[0], d[1])),
+			opExpr(ADD, opExpr(MUL, a[0], a[0]), opExpr(MUL, a[1], a[1])))
+	case SQRT:
+		// sqrt(a) = |a|^0.5, whose derivative is 0.5 a' sqrt|a| / a
+		return mulExpr(constExpr(0.5), mulExpr(d[0], opExpr(DIV, e, a[0])))
+	case SIN:
+		return mulExpr(opExpr(COS, a[0]), d[0])
+	case COS:
+		return subExpr(nil, mulExpr(opExpr(SIN, a[0]), d[0]))
+	case TAN:
+		// a' (1 + tan² a)
+		return mulExpr(d[0], opExpr(ADD, constExpr(1), opExpr(MUL, e, e)))
+	case LOG:
+		// log(a) = log|a|, whose derivative is a'/a
+		return divExpr(d[0], a[0])
+	case EXP:
+		return mulExpr(e, d[0])
+	case ABS:
+		// a'a / |a|
+		return divExpr(mulExpr(d[0], a[0]), e)
+	case FRACT:
+		return d[0]
+	case FLOOR, STEP:
+		return nil
+	case SMOOTHSTEP:
+		// With t = clamp((c - a) / (b - a), 0, 1), smoothstep(a, b, c) is
+		// t² (3 - 2t), whose derivative is 6t (1 - t) t'. That is 0 wherever t
+		// is clamped, so the clamping can be ignored when working out t'. If
+		// a = b, smoothstep is a step, whose derivative is 0.
+		width := opExpr(SUB, a[1], a[0])
+		offset := opExpr(SUB, a[2], a[0])
+		t := opExpr(MAX, constExpr(0), opExpr(MIN, constExpr(1), opExpr(DIV, offset, width)))
+		dt := divExpr(subExpr(mulExpr(subExpr(d[2], d[0]), width), mulExpr(offset, subExpr(d[1], d[0]))),
+			opExpr(MUL, width, width))
+		slope := opExpr(MUL, constExpr(6), opExpr(MUL, t, opExpr(SUB, constExpr(1), t)))
+		return selectExpr(opExpr(ABS, width), mulExpr(slope, dt), nil)
+	case SELECT:
+		return selectExpr(a[0], d[1], d[2])
+	}
+	panic("Invalid operator!")
+}
+
+// Returns the partial derivative of f with respect to variable v, which takes
+// the same variables as f. It is simplified, but can still be much longer than
+// f.
+func (f *Function) Derivative(v int) Function {
+	simplified := *f
+	simplified.Simplify()
+	d := simplified.tree().derivative(v)
+	if d == nil {
+		d = constExpr(0)
+	}
+	derivative := Function{nvars: f.nvars, seed: f.seed}
+	derivative.setTree(d)
+	derivative.Simplify()
+	return derivative
+}
+
+// Returns the partial derivatives of f with respect to each of its variables.
+func (f *Function) Gradient() []Function {
+	gradient := make([]Function, f.nvars)
+	for v := range gradient {
+		gradient[v] = f.Derivative(v)
+	}
+	return gradient
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// Returns a central finite difference of f with respect to variable v at vars.
+func finiteDifference(f *Function, v int, vars []float64, h float64) float64 {
+	shifted := append([]float64(nil), vars...)
+	shifted[v] = vars[v] + h
+	above := f.Evaluate(shifted)
+	shifted[v] = vars[v] - h
+	below := f.Evaluate(shifted)
+	return (above - below) / (2 * h)
+}
+
+func TestDerivativeFiniteDifference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	checked, total := 0, 0
+	for i, f := range testFunctions(t, 5, 300) {
+		if f.uses(SIMPLEX3) || f.uses(WORLEY2) || f.uses(WORLEY3) {
+			// The derivatives of noise are taken from points on either side of
+			// each argument, which can be on the other side of a crease of
+			// Worley noise, or of a small jump of simplex3 (which, like the
+			// reference implementation, jumps slightly from one simplex to the
+			// next), even where the function itself is smooth, e.g. simplex3
+			// of v0, v0, and 0 is always on the edge of a simplex.
+			continue
+		}
+		gradient := f.Gradient()
+		for j := 0; j < 20; j++ {
+			vars := []float64{rng.NormFloat64(), rng.NormFloat64(), rng.Float64()}
+			for v, d := range gradient {
+				total++
+				want := finiteDifference(&f, v, vars, 1e-6)
+				// Points where the two differences disagree are close to a jump
+				// or a kink, or are too steep to be estimated well. The wider
+				// one also covers the points noise derivatives are taken from.
+				if math.IsNaN(want) || math.IsInf(want, 0) || math.Abs(want) > 1e4 ||
+					math.Abs(want-finiteDifference(&f, v, vars, 1e-3)) > 1e-2*math.Max(1, math.Abs(want)) {
+					continue
+				}
+				checked++
+				got := d.Evaluate(vars)
+				if math.Abs(got-want) > 1e-3*math.Max(1, math.Abs(want)) {
+					t.Errorf("derivative of function %d (%v) with respect to variable %d at %v is %v, "+
+						"but the finite difference is %v", i, f.String(), v, vars, got, want)
+				}
+			}
+		}
+	}
+	if checked < total/2 {
+		t.Errorf("only %d of %d derivatives were checked", checked, total)
+	}
+}
+
+func TestDerivativePowOfZero(t *testing.T) {
+	// pow(0, b) is 0.01^b if b < 0, so its slope is 0.01^b log 0.01.
+	f, err := ParseFunction("autoart1 nvars=1 0 v0 pow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := f.Derivative(0)
+	for _, x := range []float64{-0.5, -2, 0.5, 2} {
+		want := 0.0
+		if x < 0 {
+			want = math.Pow(0.01, x) * math.Log(0.01)
+		}
+		if got := d.Evaluate([]float64{x}); math.Abs(got-want) > 1e-9*math.Abs(want) {
+			t.Errorf("derivative of pow(0, x) at %v is %v, not %v", x, got, want)
+		}
+	}
+}
+
+// Returns whether f uses op.
+func (f *Function) uses(op int) bool {
+	for _, o := range f.operators {
+		if o.op == op {
+			return true
+		}
+	}
+	return false
+}
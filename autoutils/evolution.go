@@ -0,0 +1,182 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Genetic programming operators
+
+A function is stored in postfix order, so every operator is the last operator
+of a subtree (the operator together with the operators which compute its
+arguments), and that subtree is a contiguous run of operators. Replacing one
+subtree with another always gives a valid function, which is what all of the
+operators below do.
+
+All of the operators take a random number generator, so that evolving a
+function is reproducible.
+*/
+
+import (
+	"math/rand"
+)
+
+const mutationRate = 0.01
+
+// Returns the index of the first operator of the subtree which ends at end.
+func subtreeStart(operators []Operator, end int) int {
+	need := 1
+	i := end + 1
+	for need > 0 {
+		i--
+		need += arity(operators[i].op) - 1
+	}
+	return i
+}
+
+// Returns a copy of operators with operators[start:end] replaced by
+// replacement.
+func splice(operators []Operator, start int, end int, replacement []Operator) []Operator {
+	spliced := make([]Operator, 0, len(operators)-(end-start)+len(replacement))
+	spliced = append(spliced, operators[:start]...)
+	spliced = append(spliced, replacement...)
+	return append(spliced, operators[end:]...)
+}
+
+// Picks a random subtree of f, returning the bounds of its operators.
+func (f *Function) randomSubtree(rng *rand.Rand) (start int, end int) {
+	end = rng.Intn(len(f.operators))
+	return subtreeStart(f.operators, end), end + 1
+}
+
+// Subtree crossover: f becomes a copy of f1 with a random subtree replaced by
+// a random subtree of f2. f may be the same as f1 or f2.
+func (f *Function) Breed(f1 *Function, f2 *Function, rng *rand.Rand) {
+	f.BreedWith(nil, f1, f2, rng)
+}
+
+// Like Breed, but if f1 has no variables, the variables of f2's subtree are
+// replaced with constants from grammar (or the default grammar if it is nil).
+func (f *Function) BreedWith(grammar *Grammar, f1 *Function, f2 *Function, rng *rand.Rand) {
+	grammar = grammar.orDefault()
+	start, end := f1.randomSubtree(rng)
+	start2, end2 := f2.randomSubtree(rng)
+	donor := make([]Operator, end2-start2)
+	copy(donor, f2.operators[start2:end2])
+	for i, op := range donor {
+		if op.op < FIRST_VAR {
+			continue
+		}
+		// Make sure the donated subtree only uses f1's variables
+		if f1.nvars == 0 {
+			donor[i] = grammar.randomConstant(rng)
+		} else {
+			donor[i].op = FIRST_VAR + (op.op-FIRST_VAR)%f1.nvars
+		}
+	}
+	seed := f1.seed
+	if seed == 0 {
+		seed = f2.seed
+	}
+	f.operators = splice(f1.operators, start, end, donor)
+	f.nvars = f1.nvars
+	f.seed = seed
+}
+
+// Point mutation: replaces a random operator with a different one which takes
+// the same number of arguments. Constants are nudged or swapped for variables,
+// and variables are swapped for other variables or constants. New operators
+// are picked using grammar (or the default grammar if it is nil).
+func (f *Function) PointMutate(grammar *Grammar, rng *rand.Rand) {
+	grammar = grammar.orDefault()
+	i := rng.Intn(len(f.operators))
+	op := &f.operators[i]
+	switch arity(op.op) {
+	case 0:
+		if op.op == CONST && rng.Intn(2) == 0 {
+			op.constant += rng.NormFloat64() / 5 // Nudge constant
+		} else {
+			*op = grammar.randomTerminal(rng, f.nvars)
+		}
+	case 1:
+		if grammar.hasUnary() {
+			op.op = grammar.randomUnary(rng)
+		}
+	case 2:
+		if grammar.hasBinary() {
+			op.op = grammar.randomBinary(rng)
+		}
+	case 3:
+		if grammar.hasTernary() {
+			op.op = grammar.randomTernary(rng)
+		}
+	}
+}
+
+// Subtree replacement: replaces a random subtree with a new random subtree of
+// up to twice its length, generated using grammar.
+func (f *Function) ReplaceSubtree(grammar *Grammar, rng *rand.Rand) {
+	grammar = grammar.orDefault()
+	start, end := f.randomSubtree(rng)
+	length := 1 + rng.Intn(2*(end-start))
+	f.operators = splice(f.operators, start, end, grammar.randomOperators(rng, f.nvars, length))
+}
+
+// Hoist mutation: replaces a random subtree with a random subtree of itself.
+func (f *Function) Hoist(rng *rand.Rand) {
+	start, end := f.randomSubtree(rng)
+	end2 := start + rng.Intn(end-start)
+	start2 := subtreeStart(f.operators, end2)
+	hoisted := append([]Operator(nil), f.operators[start2:end2+1]...)
+	f.operators = splice(f.operators, start, end, hoisted)
+}
+
+// Shrink mutation: replaces a random subtree with a random variable or
+// constant from grammar.
+func (f *Function) Shrink(grammar *Grammar, rng *rand.Rand) {
+	start, end := f.randomSubtree(rng)
+	terminal := grammar.orDefault().randomTerminal(rng, f.nvars)
+	f.operators = splice(f.operators, start, end, []Operator{terminal})
+}
+
+// Nudges some of the constants of f, and then applies one of PointMutate,
+// ReplaceSubtree, Hoist, and Shrink. Hoist and Shrink are picked less often,
+// since they always make f shorter.
+func (f *Function) Mutate(rng *rand.Rand) {
+	f.MutateWith(nil, rng)
+}
+
+// Like Mutate, but new operators are picked using grammar (or the default
+// grammar if it is nil).
+func (f *Function) MutateWith(grammar *Grammar, rng *rand.Rand) {
+	for i, op := range f.operators {
+		if op.op == CONST && rng.Float64() < mutationRate {
+			f.operators[i].constant += rng.NormFloat64() / 5 // Nudge constant
+		}
+	}
+	switch r := rng.Intn(10); {
+	case r < 4:
+		f.PointMutate(grammar, rng)
+	case r < 8:
+		f.ReplaceSubtree(grammar, rng)
+	case r < 9:
+		f.Hoist(rng)
+	default:
+		f.Shrink(grammar, rng)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// The genetic programming operators, applied to f. Breed breeds f with other.
+var geneticOperators = []struct {
+	name  string
+	apply func(f *Function, other *Function, rng *rand.Rand)
+}{
+	{"Breed", func(f *Function, other *Function, rng *rand.Rand) { f.Breed(f, other, rng) }},
+	{"PointMutate", func(f *Function, other *Function, rng *rand.Rand) { f.PointMutate(nil, rng) }},
+	{"ReplaceSubtree", func(f *Function, other *Function, rng *rand.Rand) { f.ReplaceSubtree(nil, rng) }},
+	{"Hoist", func(f *Function, other *Function, rng *rand.Rand) { f.Hoist(rng) }},
+	{"Shrink", func(f *Function, other *Function, rng *rand.Rand) { f.Shrink(nil, rng) }},
+}
+
+func TestGeneticOperators(t *testing.T) {
+	for _, o := range geneticOperators {
+		for i := 0; i < 400; i++ {
+			rng := rand.New(rand.NewSource(int64(i)))
+			var f, other Function
+			f.GenerateWith(nil, i%4, 1+rng.Intn(40), rng)
+			other.GenerateWith(nil, i/4%4, 1+rng.Intn(40), rng)
+			var a, b Function
+			a.CopyFrom(&f)
+			b.CopyFrom(&f)
+			rngA, rngB := rand.New(rand.NewSource(int64(i))), rand.New(rand.NewSource(int64(i)))
+			for j := 0; j < 5; j++ {
+				o.apply(&a, &other, rngA)
+				o.apply(&b, &other, rngB)
+				checkValid(t, &a)
+				if a.String() != b.String() {
+					t.Fatalf("%s of %v isn't reproducible: it gave %v, then %v", o.name, &f, &a, &b)
+				}
+				a.Evaluate(make([]float64, a.nvars))
+			}
+		}
+	}
+}
+
+func TestBreedWithoutVariables(t *testing.T) {
+	variables := NewGrammar()
+	variables.VariableWeight = 10
+	// The variables of the donated subtrees should become constants from this.
+	constants := NewGrammar()
+	constants.ConstMin, constants.ConstMax = 5, 6
+	rng := rand.New(rand.NewSource(1))
+	replaced := false
+	for i := 0; i < 100; i++ {
+		var f, f2 Function
+		f.GenerateWith(nil, 0, 10, rng)
+		f2.GenerateWith(variables, 3, 10, rng)
+		f.BreedWith(constants, &f, &f2, rng)
+		checkValid(t, &f)
+		f.Evaluate(nil)
+		for _, op := range f.operators {
+			if op.op == CONST && op.constant >= 5 {
+				replaced = true
+			} else if op.op == CONST && (op.constant < 0 || op.constant > 1) {
+				t.Errorf("breeding %v gave a constant which isn't from either grammar: %v", &f2, op.constant)
+			}
+		}
+	}
+	if !replaced {
+		t.Error("no variables were replaced with constants from the grammar")
+	}
+}
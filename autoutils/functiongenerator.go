@@ -20,7 +20,6 @@ along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
 package autoutils
 
 import (
-	"fmt"
 	"math"
 	"math/rand"
 )
@@ -28,24 +27,48 @@ import (
 // Operators
 const (
 	CONST = iota
+	// Binary operators
 	ADD
 	SUB
 	MUL
 	DIV
 	MIN
 	MAX
+	MOD
+	POW
+	ATAN2
+	STEP
+	PERLIN2
+	SIMPLEX2
+	VALUE2
+	WORLEY2
+	// Unary operators
 	SQRT
 	SIN
 	COS
 	TAN
 	LOG
 	EXP
+	ABS
+	FLOOR
+	FRACT
+	PERLIN1
+	VALUE1
+	// Ternary operators
+	SMOOTHSTEP
+	SELECT
+	PERLIN3
+	SIMPLEX3
+	VALUE3
+	WORLEY3
 	OPERATOR_COUNT
 )
 const FIRST_BINARY = ADD
 const FIRST_UNARY = SQRT
+const FIRST_TERNARY = SMOOTHSTEP
 const BINARY_COUNT = FIRST_UNARY - 1 // -1 for CONST
-const UNARY_COUNT = OPERATOR_COUNT - FIRST_UNARY
+const UNARY_COUNT = FIRST_TERNARY - FIRST_UNARY
+const TERNARY_COUNT = OPERATOR_COUNT - FIRST_TERNARY
 const FIRST_VAR = OPERATOR_COUNT
 
 type Operator struct {
@@ -56,170 +79,174 @@ type Operator struct {
 type Function struct {
 	nvars     int
 	operators []Operator
+	seed      int64 // Seed for noise operators
 }
 
-// Generate a random function f with the given length (i.e. len(f.operators))
-// and the given number of variables
-func (f *Function) Generate(nvars int, length int) {
-	f.nvars = nvars
-	f.operators = make([]Operator, length)
-	nsOnStack := 0
-	i := 0
-	for nsOnStack+i < length {
-		var operator Operator
-		var optype int
-		if nsOnStack == 0 {
-			// Pick a random variable
-			optype = 0
-		} else if nsOnStack == 1 {
-			// Pick a constant/variable/unary operator
-			optype = rand.Intn(3)
-		} else {
-			// Pick a constant/variable/unary/binary operator
-			optype = rand.Intn(4)
-		}
-		switch optype {
-		case 0:
-			// variable
-			operator.op = FIRST_VAR + rand.Intn(nvars)
-			nsOnStack++
-		case 1:
-			// Constant
-			operator.op = CONST
-			operator.constant = rand.Float64()
-			nsOnStack++
-		case 2:
-			// unary
-			operator.op = rand.Intn(UNARY_COUNT) + FIRST_UNARY
-		case 3:
-			// binary
-			operator.op = rand.Intn(BINARY_COUNT) + FIRST_BINARY
-			nsOnStack--
-		}
-		f.operators[i] = operator
-		i++
-	}
+// Returns the number of variables f takes.
+func (f *Function) NVars() int {
+	return f.nvars
+}
 
-	if nsOnStack+i == length {
-		// Add a unary operator
-		f.operators[i].op = rand.Intn(UNARY_COUNT) + FIRST_UNARY
-		i++
+// Returns the number of values op pops off of the stack. Variables and
+// constants pop nothing.
+func arity(op int) int {
+	switch {
+	case op == CONST || op >= FIRST_VAR:
+		return 0
+	case op < FIRST_UNARY:
+		return 2
+	case op >= FIRST_TERNARY:
+		return 3
 	}
+	return 1
+}
 
-	// Keep adding binary operators until nsOnStack == 1
-	for nsOnStack > 1 {
-		f.operators[i].op = rand.Intn(BINARY_COUNT) + FIRST_BINARY
-		nsOnStack--
-		i++
-	}
+// Generate a random function f with the given length (i.e. len(f.operators))
+// and the given number of variables
+func (f *Function) Generate(nvars int, length int, rng *rand.Rand) {
+	f.GenerateWith(nil, nvars, length, rng)
+}
 
+// Like Generate, but uses the given grammar (or the default grammar if it is
+// nil).
+func (f *Function) GenerateWith(grammar *Grammar, nvars int, length int, rng *rand.Rand) {
+	f.nvars = nvars
+	f.operators = grammar.orDefault().randomOperators(rng, nvars, length)
+	f.seed = 0
+	if f.noiseTables() != nil {
+		f.seed = rng.Int63()
+	}
 }
 
-func (f *Function) Evaluate(vars []float64) float64 {
-	var stack []float64
+// Returns the noise tables for f, or nil if f doesn't use noise.
+func (f *Function) noiseTables() *noiseTables {
 	for _, op := range f.operators {
-		l := len(stack)
-		switch op.op {
-		case CONST:
-			stack = append(stack, op.constant)
-		case ADD:
-			stack[l-2] += stack[l-1]
-			stack = stack[:l-1]
-		case SUB:
-			stack[l-2] -= stack[l-1]
-			stack = stack[:l-1]
-		case MUL:
-			stack[l-2] *= stack[l-1]
-			stack = stack[:l-1]
-		case DIV:
-			if stack[l-1] == 0 { // Check for division by 0
-				stack[l-1] = 0.01
-			}
-			stack[l-2] /= stack[l-1]
-			stack = stack[:l-1]
-		case MIN:
-			stack[l-2] = math.Min(stack[l-2], stack[l-1])
-			stack = stack[:l-1]
-		case MAX:
-			stack[l-2] = math.Max(stack[l-2], stack[l-1])
-			stack = stack[:l-1]
-		case SQRT:
-			stack[l-1] = math.Sqrt(math.Abs(stack[l-1]))
-		case SIN:
-			stack[l-1] = math.Sin(stack[l-1])
-		case COS:
-			stack[l-1] = math.Cos(stack[l-1])
-		case TAN:
-			stack[l-1] = math.Tan(stack[l-1])
-		case LOG:
-			stack[l-1] = math.Log(math.Abs(stack[l-1]))
-		case EXP:
-			stack[l-1] = math.Exp(stack[l-1])
-		default:
-			stack = append(stack, vars[op.op-FIRST_VAR])
+		if isNoise(op.op) {
+			return noiseTablesFor(f.seed)
 		}
 	}
-	return stack[0]
+	return nil
 }
 
-func (f *Function) String() string {
-	var str string
-	for _, op := range f.operators {
-		switch op.op {
-		case CONST:
-			str += fmt.Sprintf("%v", op.constant)
-		case ADD:
-			str += "+"
-		case SUB:
-			str += "-"
-		case MUL:
-			str += "*"
-		case DIV:
-			str += "/"
-		case SQRT:
-			str += "sqrt"
-		case SIN:
-			str += "sin"
-		case COS:
-			str += "cos"
-		case TAN:
-			str += "tan"
-		default:
-			str += fmt.Sprintf("v%v", op.op-FIRST_VAR)
+func applyBinary(op int, a float64, b float64, t *noiseTables) float64 {
+	switch op {
+	case ADD:
+		return a + b
+	case SUB:
+		return a - b
+	case MUL:
+		return a * b
+	case DIV:
+		if b == 0 { // Check for division by 0
+			b = 0.01
+		}
+		return a / b
+	case MIN:
+		return math.Min(a, b)
+	case MAX:
+		return math.Max(a, b)
+	case MOD:
+		if b == 0 {
+			b = 0.01
 		}
-		str += " "
+		return a - b*math.Floor(a/b)
+	case POW:
+		a = math.Abs(a)
+		if a == 0 && b < 0 { // Same as 1 / 0
+			a = 0.01
+		}
+		return math.Pow(a, b)
+	case ATAN2:
+		return math.Atan2(a, b)
+	case STEP:
+		if b < a {
+			return 0
+		}
+		return 1
+	case PERLIN2, SIMPLEX2, VALUE2, WORLEY2:
+		return t.binary(op, a, b)
 	}
-	return str
+	panic("Invalid binary operator!")
 }
 
-const mutationRate = 0.01
+func applyUnary(op int, a float64, t *noiseTables) float64 {
+	switch op {
+	case SQRT:
+		return math.Sqrt(math.Abs(a))
+	case SIN:
+		return math.Sin(a)
+	case COS:
+		return math.Cos(a)
+	case TAN:
+		return math.Tan(a)
+	case LOG:
+		return math.Log(math.Abs(a))
+	case EXP:
+		return math.Exp(a)
+	case ABS:
+		return math.Abs(a)
+	case FLOOR:
+		return math.Floor(a)
+	case FRACT:
+		return a - math.Floor(a)
+	case PERLIN1, VALUE1:
+		return t.unary(op, a)
+	}
+	panic("Invalid unary operator!")
+}
 
-func (f *Function) Mutate() {
-	for i, op := range f.operators {
-		if op.op == CONST && rand.Float64() < mutationRate {
-			f.operators[i].constant += rand.NormFloat64() / 5 // Nudge constant
+func applyTernary(op int, a float64, b float64, c float64, t *noiseTables) float64 {
+	switch op {
+	case SMOOTHSTEP:
+		// Smooth step from a to b, evaluated at c
+		if a == b {
+			return applyBinary(STEP, a, c, t)
+		}
+		t := math.Max(0, math.Min(1, (c-a)/(b-a)))
+		return t * t * (3 - 2*t)
+	case SELECT:
+		if a > 0 {
+			return b
 		}
+		return c
+	case PERLIN3, SIMPLEX3, VALUE3, WORLEY3:
+		return t.ternary(op, a, b, c)
 	}
+	panic("Invalid ternary operator!")
 }
 
-func (f *Function) Breed(f1 *Function, f2 *Function) {
-	// f(x) = (f1(x) + f2(x)) / 2
-	f.operators = make([]Operator, len(f1.operators)+len(f2.operators)+3)
-	for i, o := range f1.operators {
-		f.operators[i] = o
-	}
-	for i, o := range f2.operators {
-		f.operators[i+len(f1.operators)] = o
+// Returns the value of f when variable v is vars[v]. This is the slow,
+// straightforward way, which compiled functions are tested against: it makes a
+// new stack and looks up f's noise tables (taking a lock) on every call. Use
+// Compile to evaluate f many times, e.g. once per pixel.
+func (f *Function) Evaluate(vars []float64) float64 {
+	var stack []float64
+	t := f.noiseTables()
+	for _, op := range f.operators {
+		l := len(stack)
+		switch arity(op.op) {
+		case 0:
+			if op.op == CONST {
+				stack = append(stack, op.constant)
+			} else {
+				stack = append(stack, vars[op.op-FIRST_VAR])
+			}
+		case 1:
+			stack[l-1] = applyUnary(op.op, stack[l-1], t)
+		case 2:
+			stack[l-2] = applyBinary(op.op, stack[l-2], stack[l-1], t)
+			stack = stack[:l-1]
+		case 3:
+			stack[l-3] = applyTernary(op.op, stack[l-3], stack[l-2], stack[l-1], t)
+			stack = stack[:l-2]
+		}
 	}
-	i := len(f1.operators) + len(f2.operators)
-	f.operators[i].op = ADD
-	f.operators[i+1].op = CONST
-	f.operators[i+1].constant = 2
-	f.operators[i+2].op = DIV
+	return stack[0]
 }
 
 func (f *Function) CopyFrom(other *Function) {
 	f.nvars = other.nvars
+	f.seed = other.seed
 	f.operators = make([]Operator, len(other.operators))
 	for i, op := range other.operators {
 		f.operators[i] = op
@@ -0,0 +1,200 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Text format for functions
+
+A function is written as a version tag, the number of variables, and then the
+operators of the function in postfix order, all separated by whitespace:
+
+	autoart1 nvars=2 v0 v1 + 0.5 * sin
+
+is sin((v0 + v1) * 0.5). Constants are written so that they parse back to
+exactly the same float64. Variables are written as v0, v1, etc. The other
+operators are written as:
+
+	binary:  + - * / min max mod pow atan2 step perlin2 simplex2 value2 worley2
+	unary:   sqrt sin cos tan log exp abs floor fract perlin1 value1
+	ternary: smoothstep select perlin3 simplex3 value3 worley3
+
+"a b c select" is b if a > 0, and c otherwise, and "a b c smoothstep" goes
+smoothly from 0 to 1 as c goes from a to b. A function which uses noise also
+has a seed for the noise, written after nvars:
+
+	autoart1 nvars=2 seed=12345 v0 v1 perlin2 sin
+
+If the format ever changes, the version tag will be changed too, so old
+functions can still be read.
+*/
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const functionTextVersion = "autoart1"
+
+var operatorNames = [OPERATOR_COUNT]string{
+	CONST:      "",
+	ADD:        "+",
+	SUB:        "-",
+	MUL:        "*",
+	DIV:        "/",
+	MIN:        "min",
+	MAX:        "max",
+	MOD:        "mod",
+	POW:        "pow",
+	ATAN2:      "atan2",
+	STEP:       "step",
+	SQRT:       "sqrt",
+	SIN:        "sin",
+	COS:        "cos",
+	TAN:        "tan",
+	LOG:        "log",
+	EXP:        "exp",
+	ABS:        "abs",
+	FLOOR:      "floor",
+	FRACT:      "fract",
+	SMOOTHSTEP: "smoothstep",
+	SELECT:     "select",
+	PERLIN1:    "perlin1",
+	PERLIN2:    "perlin2",
+	PERLIN3:    "perlin3",
+	SIMPLEX2:   "simplex2",
+	SIMPLEX3:   "simplex3",
+	VALUE1:     "value1",
+	VALUE2:     "value2",
+	VALUE3:     "value3",
+	WORLEY2:    "worley2",
+	WORLEY3:    "worley3",
+}
+
+func (o Operator) String() string {
+	switch {
+	case o.op == CONST:
+		return strconv.FormatFloat(o.constant, 'g', -1, 64)
+	case o.op >= FIRST_VAR:
+		return fmt.Sprintf("v%d", o.op-FIRST_VAR)
+	}
+	return operatorNames[o.op]
+}
+
+// Returns f in the text format described above.
+func (f *Function) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s nvars=%d", functionTextVersion, f.nvars)
+	if f.seed != 0 {
+		fmt.Fprintf(&b, " seed=%d", f.seed)
+	}
+	for _, op := range f.operators {
+		b.WriteByte(' ')
+		b.WriteString(op.String())
+	}
+	return b.String()
+}
+
+func (f Function) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *Function) UnmarshalText(text []byte) error {
+	g, err := ParseFunction(string(text))
+	if err != nil {
+		return err
+	}
+	*f = g
+	return nil
+}
+
+func parseOperator(token string, nvars int) (Operator, error) {
+	for op, name := range operatorNames {
+		if op != CONST && token == name {
+			return Operator{op: op}, nil
+		}
+	}
+	if token[0] == 'v' {
+		v, err := strconv.Atoi(token[1:])
+		if err != nil || v < 0 {
+			return Operator{}, fmt.Errorf("invalid variable %q", token)
+		}
+		if v >= nvars {
+			return Operator{}, fmt.Errorf("variable %q out of range (function has %d variables)", token, nvars)
+		}
+		return Operator{op: FIRST_VAR + v}, nil
+	}
+	c, err := strconv.ParseFloat(token, 64)
+	if err != nil {
+		return Operator{}, fmt.Errorf("unknown operator %q", token)
+	}
+	return Operator{op: CONST, constant: c}, nil
+}
+
+// Parses a function written in the text format described above. An error is
+// returned if the text is not a valid function, e.g. if an operator doesn't
+// have enough operands.
+func ParseFunction(text string) (Function, error) {
+	var f Function
+	tokens := strings.Fields(text)
+	if len(tokens) == 0 {
+		return f, fmt.Errorf("empty function")
+	}
+	if tokens[0] != functionTextVersion {
+		return f, fmt.Errorf("unsupported function format %q (expected %q)", tokens[0], functionTextVersion)
+	}
+	if len(tokens) < 2 || !strings.HasPrefix(tokens[1], "nvars=") {
+		return f, fmt.Errorf("missing nvars")
+	}
+	nvars, err := strconv.Atoi(strings.TrimPrefix(tokens[1], "nvars="))
+	if err != nil || nvars < 0 {
+		return f, fmt.Errorf("invalid number of variables %q", tokens[1])
+	}
+	tokens = tokens[2:]
+	if len(tokens) > 0 && strings.HasPrefix(tokens[0], "seed=") {
+		f.seed, err = strconv.ParseInt(strings.TrimPrefix(tokens[0], "seed="), 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid noise seed %q", tokens[0])
+		}
+		tokens = tokens[1:]
+	}
+	if len(tokens) == 0 {
+		return f, fmt.Errorf("function has no operators")
+	}
+	f.nvars = nvars
+	f.operators = make([]Operator, len(tokens))
+	depth := 0
+	for i, token := range tokens {
+		op, err := parseOperator(token, nvars)
+		if err != nil {
+			return Function{}, fmt.Errorf("operator %d: %v", i+1, err)
+		}
+		n := arity(op.op)
+		if depth < n {
+			return Function{}, fmt.Errorf("operator %d: %q needs %d operands, but there are only %d", i+1, token, n, depth)
+		}
+		depth += 1 - n
+		f.operators[i] = op
+	}
+	if depth != 1 {
+		return Function{}, fmt.Errorf("function leaves %d values on the stack (expected 1)", depth)
+	}
+	return f, nil
+}
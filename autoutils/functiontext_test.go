@@ -0,0 +1,124 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// Returns whether f and g are the same, with constants compared bit for bit.
+func sameFunction(f *Function, g *Function) bool {
+	if f.nvars != g.nvars || f.seed != g.seed || len(f.operators) != len(g.operators) {
+		return false
+	}
+	for i, op := range f.operators {
+		other := g.operators[i]
+		if op.op != other.op || math.Float64bits(op.constant) != math.Float64bits(other.constant) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestFunctionTextRoundTrip(t *testing.T) {
+	functions := testFunctions(t, 4, 200)
+	functions = append(functions, Function{nvars: 1, operators: []Operator{
+		{op: CONST, constant: math.Inf(1)}, {op: CONST, constant: math.Copysign(0, -1)}, {op: ADD},
+		{op: CONST, constant: 1e-310}, {op: MUL}, {op: CONST, constant: math.NaN()}, {op: MIN},
+		{op: CONST, constant: math.Inf(-1)}, {op: FIRST_VAR}, {op: SELECT},
+	}})
+	for i := range functions {
+		f := &functions[i]
+		g, err := ParseFunction(f.String())
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if !sameFunction(f, &g) {
+			t.Fatalf("%v was parsed as %v", f, &g)
+		}
+		text, err := f.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var h Function
+		if err = h.UnmarshalText(text); err != nil {
+			t.Fatalf("%s: %v", text, err)
+		}
+		if !sameFunction(f, &h) {
+			t.Fatalf("%s was unmarshaled as %v", text, &h)
+		}
+	}
+}
+
+func TestParseFunction(t *testing.T) {
+	f, err := ParseFunction("autoart1 nvars=2 v0 v1 + 0.5 * sin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.Evaluate([]float64{0.3, 0.9}), math.Sin((0.3+0.9)*0.5); got != want {
+		t.Errorf("got %v, expected %v", got, want)
+	}
+	f, err = ParseFunction("  autoart1\tnvars=2 seed=12345\nv0 v1 perlin2 sin ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.seed != 12345 || len(f.operators) != 4 {
+		t.Errorf("parsed as %v", &f)
+	}
+}
+
+func TestParseFunctionErrors(t *testing.T) {
+	tests := []struct {
+		text  string
+		error string
+	}{
+		{"", "empty function"},
+		{"autoart2 nvars=1 v0", "unsupported function format"},
+		{"nvars=1 v0", "unsupported function format"},
+		{"autoart1 v0", "missing nvars"},
+		{"autoart1", "missing nvars"},
+		{"autoart1 nvars=x v0", "invalid number of variables"},
+		{"autoart1 nvars=-1 v0", "invalid number of variables"},
+		{"autoart1 nvars=1 seed=x v0", "invalid noise seed"},
+		{"autoart1 nvars=1", "no operators"},
+		{"autoart1 nvars=1 seed=3", "no operators"},
+		{"autoart1 nvars=1 +", "needs 2 operands"},
+		{"autoart1 nvars=1 v0 +", "needs 2 operands"},
+		{"autoart1 nvars=1 v0 v0 select", "needs 3 operands"},
+		{"autoart1 nvars=1 v0 v0", "leaves 2 values"},
+		{"autoart1 nvars=1 v0 1 2 + 3", "leaves 3 values"},
+		{"autoart1 nvars=1 v1", "out of range"},
+		{"autoart1 nvars=0 v0 sin", "out of range"},
+		{"autoart1 nvars=1 vx", "invalid variable"},
+		{"autoart1 nvars=1 v-1", "invalid variable"},
+		{"autoart1 nvars=1 v0 frobnicate", "unknown operator"},
+		{"autoart1 nvars=1 v0 1,5 +", "unknown operator"},
+	}
+	for _, test := range tests {
+		_, err := ParseFunction(test.text)
+		if err == nil {
+			t.Errorf("%q parsed without an error", test.text)
+		} else if !strings.Contains(err.Error(), test.error) {
+			t.Errorf("%q: got error %q, expected %q", test.text, err, test.error)
+		}
+	}
+}
@@ -0,0 +1,479 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+GLSL
+
+GLSL turns functions into GLSL ES 3.00 code (which works in WebGL 2, and so on
+Shadertoy), so that they can be evaluated on the GPU. The operators work the
+same way as they do here (e.g. dividing by 0 divides by 0.01 instead), and the
+noise operators use the same tables, so the results are the same, except that
+GPUs use 32-bit floats. Usually that makes no visible difference, but functions
+which magnify small differences (e.g. tan of something big) will look different.
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Helper functions for operators which GLSL doesn't have, or which work
+// differently in GLSL
+const glslHelpers = `// Unlike GLSL's min and max, these return NaN if either argument is NaN.
+float aa_min(float a, float b) {
+	return isnan(a) || isnan(b) ? a + b : min(a, b);
+}
+
+float aa_max(float a, float b) {
+	return isnan(a) || isnan(b) ? a + b : max(a, b);
+}
+
+float aa_div(float a, float b) {
+	return a / (b == 0.0 ? 0.01 : b);
+}
+
+float aa_mod(float a, float b) {
+	if (b == 0.0) b = 0.01;
+	return a - b * floor(a / b);
+}
+
+float aa_pow(float a, float b) {
+	a = abs(a);
+	if (b == 0.0) return 1.0;
+	if (a == 0.0 && b < 0.0) a = 0.01;
+	return pow(a, b);
+}
+
+float aa_atan2(float a, float b) {
+	return a == 0.0 && b == 0.0 ? 0.0 : atan(a, b);
+}
+
+float aa_step(float a, float b) {
+	return b < a ? 0.0 : 1.0;
+}
+
+float aa_smoothstep(float a, float b, float c) {
+	if (a == b) return aa_step(a, c);
+	float t = aa_max(0.0, aa_min(1.0, (c - a) / (b - a)));
+	return t * t * (3.0 - 2.0 * t);
+}
+
+float aa_select(float a, float b, float c) {
+	return a > 0.0 ? b : c;
+}
+`
+
+// Noise functions, which take the offset of their tables in aa_perm and
+// aa_values
+const glslNoise = `int aa_hash(int o, int i) {
+	return aa_perm[o + (i & 255)];
+}
+
+int aa_hash2(int o, int i, int j) {
+	return aa_perm[o + ((aa_hash(o, i) + (j & 255)) & 255)];
+}
+
+int aa_hash3(int o, int i, int j, int k) {
+	return aa_perm[o + ((aa_hash2(o, i, j) + (k & 255)) & 255)];
+}
+
+float aa_fade(float t) {
+	return t * t * t * (t * (t * 6.0 - 15.0) + 10.0);
+}
+
+float aa_lerp(float t, float a, float b) {
+	return a + t * (b - a);
+}
+
+float aa_unit(float x) {
+	return max(0.0, min(1.0, 0.5 + 0.5 * x));
+}
+
+float aa_noise_arg(float x) {
+	x *= %d.0;
+	return isnan(x) || abs(x) > 1e9 ? 0.0 : x;
+}
+
+float aa_grad1(int h, float x) {
+	float g = float((h & 7) + 1) / 8.0;
+	return ((h & 8) != 0 ? -g : g) * x;
+}
+
+float aa_grad2(int h, float x, float y) {
+	switch (h & 7) {
+	case 0: return x + y;
+	case 1: return -x + y;
+	case 2: return x - y;
+	case 3: return -x - y;
+	case 4: return x;
+	case 5: return -x;
+	case 6: return y;
+	}
+	return -y;
+}
+
+float aa_grad3(int h, float x, float y, float z) {
+	h &= 15;
+	float u = h < 8 ? x : y;
+	float v = h < 4 ? y : (h == 12 || h == 14 ? x : z);
+	return ((h & 1) != 0 ? -u : u) + ((h & 2) != 0 ? -v : v);
+}
+
+float aa_perlin1(int o, float x) {
+	x = aa_noise_arg(x);
+	int i = int(floor(x));
+	float fx = x - floor(x);
+	return aa_unit(2.0 * aa_lerp(aa_fade(fx), aa_grad1(aa_hash(o, i), fx), aa_grad1(aa_hash(o, i + 1), fx - 1.0)));
+}
+
+float aa_perlin2(int o, float x, float y) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float u = aa_fade(fx);
+	float v = aa_fade(fy);
+	return aa_unit(aa_lerp(v,
+		aa_lerp(u, aa_grad2(aa_hash2(o, i, j), fx, fy), aa_grad2(aa_hash2(o, i + 1, j), fx - 1.0, fy)),
+		aa_lerp(u, aa_grad2(aa_hash2(o, i, j + 1), fx, fy - 1.0), aa_grad2(aa_hash2(o, i + 1, j + 1), fx - 1.0, fy - 1.0))));
+}
+
+float aa_perlin3_corner(int o, int i, int j, int k, float fx, float fy, float fz, int di, int dj, int dk) {
+	return aa_grad3(aa_hash3(o, i + di, j + dj, k + dk), fx - float(di), fy - float(dj), fz - float(dk));
+}
+
+float aa_perlin3(int o, float x, float y, float z) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	z = aa_noise_arg(z);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	int k = int(floor(z));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float fz = z - floor(z);
+	float u = aa_fade(fx);
+	float v = aa_fade(fy);
+	float w = aa_fade(fz);
+	return aa_unit(aa_lerp(w,
+		aa_lerp(v,
+			aa_lerp(u, aa_perlin3_corner(o, i, j, k, fx, fy, fz, 0, 0, 0), aa_perlin3_corner(o, i, j, k, fx, fy, fz, 1, 0, 0)),
+			aa_lerp(u, aa_perlin3_corner(o, i, j, k, fx, fy, fz, 0, 1, 0), aa_perlin3_corner(o, i, j, k, fx, fy, fz, 1, 1, 0))),
+		aa_lerp(v,
+			aa_lerp(u, aa_perlin3_corner(o, i, j, k, fx, fy, fz, 0, 0, 1), aa_perlin3_corner(o, i, j, k, fx, fy, fz, 1, 0, 1)),
+			aa_lerp(u, aa_perlin3_corner(o, i, j, k, fx, fy, fz, 0, 1, 1), aa_perlin3_corner(o, i, j, k, fx, fy, fz, 1, 1, 1)))));
+}
+
+float aa_simplex2_corner(int h, float x, float y) {
+	float r = 0.5 - x * x - y * y;
+	if (r <= 0.0) return 0.0;
+	r *= r;
+	return r * r * aa_grad2(h, x, y);
+}
+
+float aa_simplex2(int o, float x, float y) {
+	const float f2 = 0.36602540378443865;
+	const float g2 = 0.21132486540518713;
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	float s = (x + y) * f2;
+	int i = int(floor(x + s));
+	int j = int(floor(y + s));
+	float u = float(i + j) * g2;
+	float x0 = x - (float(i) - u);
+	float y0 = y - (float(j) - u);
+	int i1 = x0 > y0 ? 1 : 0;
+	int j1 = 1 - i1;
+	float n = 0.0;
+	n += aa_simplex2_corner(aa_hash2(o, i, j), x0, y0);
+	n += aa_simplex2_corner(aa_hash2(o, i + i1, j + j1), x0 - float(i1) + g2, y0 - float(j1) + g2);
+	n += aa_simplex2_corner(aa_hash2(o, i + 1, j + 1), x0 - 1.0 + 2.0 * g2, y0 - 1.0 + 2.0 * g2);
+	return aa_unit(70.0 * n);
+}
+
+float aa_simplex3_corner(int h, float x, float y, float z) {
+	float r = 0.6 - x * x - y * y - z * z;
+	if (r <= 0.0) return 0.0;
+	r *= r;
+	return r * r * aa_grad3(h, x, y, z);
+}
+
+float aa_simplex3(int o, float x, float y, float z) {
+	const float f3 = 1.0 / 3.0;
+	const float g3 = 1.0 / 6.0;
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	z = aa_noise_arg(z);
+	float s = (x + y + z) * f3;
+	int i = int(floor(x + s));
+	int j = int(floor(y + s));
+	int k = int(floor(z + s));
+	float u = float(i + j + k) * g3;
+	float x0 = x - (float(i) - u);
+	float y0 = y - (float(j) - u);
+	float z0 = z - (float(k) - u);
+	// Find which of the six simplices we're in
+	int i1 = 0, j1 = 0, k1 = 0, i2 = 0, j2 = 0, k2 = 0;
+	if (x0 >= y0 && y0 >= z0) {
+		i1 = 1; i2 = 1; j2 = 1;
+	} else if (x0 >= y0 && x0 >= z0) {
+		i1 = 1; i2 = 1; k2 = 1;
+	} else if (x0 >= y0) {
+		k1 = 1; i2 = 1; k2 = 1;
+	} else if (y0 < z0) {
+		k1 = 1; j2 = 1; k2 = 1;
+	} else if (x0 < z0) {
+		j1 = 1; j2 = 1; k2 = 1;
+	} else {
+		j1 = 1; i2 = 1; j2 = 1;
+	}
+	float n = 0.0;
+	n += aa_simplex3_corner(aa_hash3(o, i, j, k), x0, y0, z0);
+	n += aa_simplex3_corner(aa_hash3(o, i + i1, j + j1, k + k1),
+		x0 - float(i1) + g3, y0 - float(j1) + g3, z0 - float(k1) + g3);
+	n += aa_simplex3_corner(aa_hash3(o, i + i2, j + j2, k + k2),
+		x0 - float(i2) + 2.0 * g3, y0 - float(j2) + 2.0 * g3, z0 - float(k2) + 2.0 * g3);
+	n += aa_simplex3_corner(aa_hash3(o, i + 1, j + 1, k + 1),
+		x0 - 1.0 + 3.0 * g3, y0 - 1.0 + 3.0 * g3, z0 - 1.0 + 3.0 * g3);
+	return aa_unit(32.0 * n);
+}
+
+float aa_value1(int o, float x) {
+	x = aa_noise_arg(x);
+	int i = int(floor(x));
+	float fx = x - floor(x);
+	return aa_lerp(aa_fade(fx), aa_values[o + aa_hash(o, i)], aa_values[o + aa_hash(o, i + 1)]);
+}
+
+float aa_value2(int o, float x, float y) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float u = aa_fade(fx);
+	float v = aa_fade(fy);
+	return aa_lerp(v,
+		aa_lerp(u, aa_values[o + aa_hash2(o, i, j)], aa_values[o + aa_hash2(o, i + 1, j)]),
+		aa_lerp(u, aa_values[o + aa_hash2(o, i, j + 1)], aa_values[o + aa_hash2(o, i + 1, j + 1)]));
+}
+
+float aa_value3_corner(int o, int i, int j, int k) {
+	return aa_values[o + aa_hash3(o, i, j, k)];
+}
+
+float aa_value3(int o, float x, float y, float z) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	z = aa_noise_arg(z);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	int k = int(floor(z));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float fz = z - floor(z);
+	float u = aa_fade(fx);
+	float v = aa_fade(fy);
+	float w = aa_fade(fz);
+	return aa_lerp(w,
+		aa_lerp(v,
+			aa_lerp(u, aa_value3_corner(o, i, j, k), aa_value3_corner(o, i + 1, j, k)),
+			aa_lerp(u, aa_value3_corner(o, i, j + 1, k), aa_value3_corner(o, i + 1, j + 1, k))),
+		aa_lerp(v,
+			aa_lerp(u, aa_value3_corner(o, i, j, k + 1), aa_value3_corner(o, i + 1, j, k + 1)),
+			aa_lerp(u, aa_value3_corner(o, i, j + 1, k + 1), aa_value3_corner(o, i + 1, j + 1, k + 1))));
+}
+
+float aa_worley2(int o, float x, float y) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float best = uintBitsToFloat(0x7f800000u);
+	for (int dj = -1; dj <= 1; dj++) {
+		for (int di = -1; di <= 1; di++) {
+			int h = aa_hash2(o, i + di, j + dj);
+			float px = float(di) + aa_values[o + h] - fx;
+			float py = float(dj) + aa_values[o + aa_perm[o + ((h + 1) & 255)]] - fy;
+			best = min(best, px * px + py * py);
+		}
+	}
+	return sqrt(best / 2.0);
+}
+
+float aa_worley3(int o, float x, float y, float z) {
+	x = aa_noise_arg(x);
+	y = aa_noise_arg(y);
+	z = aa_noise_arg(z);
+	int i = int(floor(x));
+	int j = int(floor(y));
+	int k = int(floor(z));
+	float fx = x - floor(x);
+	float fy = y - floor(y);
+	float fz = z - floor(z);
+	float best = uintBitsToFloat(0x7f800000u);
+	for (int dk = -1; dk <= 1; dk++) {
+		for (int dj = -1; dj <= 1; dj++) {
+			for (int di = -1; di <= 1; di++) {
+				int h = aa_hash3(o, i + di, j + dj, k + dk);
+				float px = float(di) + aa_values[o + h] - fx;
+				float py = float(dj) + aa_values[o + aa_perm[o + ((h + 1) & 255)]] - fy;
+				float pz = float(dk) + aa_values[o + aa_perm[o + ((h + 2) & 255)]] - fz;
+				best = min(best, px * px + py * py + pz * pz);
+			}
+		}
+	}
+	return sqrt(best / 3.0);
+}
+`
+
+// Names of the GLSL functions for operators which are written as calls
+var glslFunctions = map[int]string{
+	DIV:        "aa_div",
+	MIN:        "aa_min",
+	MAX:        "aa_max",
+	MOD:        "aa_mod",
+	POW:        "aa_pow",
+	ATAN2:      "aa_atan2",
+	STEP:       "aa_step",
+	SIN:        "sin",
+	COS:        "cos",
+	TAN:        "tan",
+	EXP:        "exp",
+	ABS:        "abs",
+	FLOOR:      "floor",
+	FRACT:      "fract",
+	SMOOTHSTEP: "aa_smoothstep",
+	SELECT:     "aa_select",
+}
+
+// Returns c as a GLSL float.
+func GLSLFloat(c float64) string {
+	f := float32(c)
+	switch {
+	case f != f:
+		return "uintBitsToFloat(0x7fc00000u)"
+	case math.IsInf(float64(f), 1):
+		return "uintBitsToFloat(0x7f800000u)"
+	case math.IsInf(float64(f), -1):
+		return "uintBitsToFloat(0xff800000u)"
+	}
+	s := strconv.FormatFloat(float64(f), 'g', -1, 32)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// Returns e as a GLSL expression. offset is the offset of the noise tables of
+// the function e is from.
+func (e *expr) glsl(names []string, offset int) string {
+	op := e.op.op
+	switch {
+	case op == CONST:
+		return GLSLFloat(e.op.constant)
+	case op >= FIRST_VAR:
+		return names[op-FIRST_VAR]
+	}
+	args := make([]string, len(e.args))
+	for i, arg := range e.args {
+		args[i] = arg.glsl(names, offset)
+	}
+	switch op {
+	case ADD:
+		return "(" + args[0] + " + " + args[1] + ")"
+	case SUB:
+		return "(" + args[0] + " - " + args[1] + ")"
+	case MUL:
+		return "(" + args[0] + " * " + args[1] + ")"
+	case SQRT:
+		return "sqrt(abs(" + args[0] + "))"
+	case LOG:
+		return "log(abs(" + args[0] + "))"
+	}
+	if isNoise(op) {
+		args = append([]string{strconv.Itoa(offset)}, args...)
+		return "aa_" + operatorNames[op] + "(" + strings.Join(args, ", ") + ")"
+	}
+	return glslFunctions[op] + "(" + strings.Join(args, ", ") + ")"
+}
+
+// Returns the declaration of a constant GLSL array.
+func glslTable(typ string, name string, entries []string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "const %s %s[%d] = %s[%d](", typ, name, len(entries), typ, len(entries))
+	for i, entry := range entries {
+		if i%16 == 0 {
+			b.WriteString("\n\t")
+		} else {
+			b.WriteByte(' ')
+		}
+		b.WriteString(entry)
+		if i < len(entries)-1 {
+			b.WriteByte(',')
+		}
+	}
+	b.WriteString("\n);\n")
+	return b.String()
+}
+
+/*
+Returns GLSL code for functions: declarations (of helper functions, and noise
+tables if they're needed), which should go before any code which uses the
+functions, and a GLSL expression for each function, where variable v is called
+names[v]. The functions are simplified first. All of the names in the
+declarations start with aa_.
+*/
+func GLSL(functions []Function, names []string) (string, []string) {
+	var perm, values []string
+	offsets := make(map[int64]int)
+	expressions := make([]string, len(functions))
+	for i := range functions {
+		var f Function
+		f.CopyFrom(&functions[i])
+		f.Simplify()
+		t := f.noiseTables()
+		if t != nil {
+			if _, ok := offsets[f.seed]; !ok {
+				offsets[f.seed] = len(perm)
+				for j, p := range t.perm[:256] {
+					perm = append(perm, strconv.Itoa(p))
+					values = append(values, GLSLFloat(t.values[j]))
+				}
+			}
+		}
+		expressions[i] = f.tree().glsl(names, offsets[f.seed])
+	}
+	declarations := glslHelpers
+	if len(perm) > 0 {
+		declarations += "\n" + glslTable("int", "aa_perm", perm) + "\n" +
+			glslTable("float", "aa_values", values) +
+			"\n" + fmt.Sprintf(glslNoise, noiseFrequency)
+	}
+	return declarations, expressions
+}
@@ -0,0 +1,395 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Grammars
+
+A Grammar controls which operators random functions are made of, and how
+often each one is picked. While a function is being generated, each step
+chooses between a variable, a constant, and a unary, binary, or ternary
+operator (according to VariableWeight, ConstantWeight, UnaryWeight,
+BinaryWeight, and TernaryWeight), and then picks an operator of that kind
+according to Weights. An operator with a weight of 0 is never used.
+
+In JSON (e.g. in presets), a grammar looks like this:
+
+	{
+		"only": ["+", "*", "sin", "cos"],
+		"operators": {"sin": 3},
+		"variables": 1,
+		"constants": 1,
+		"unary": 1,
+		"binary": 1,
+		"ternary": 1,
+		"constMin": 0,
+		"constMax": 1
+	}
+
+All of the fields are optional. If "only" is given, the operators which aren't
+in it get a weight of 0. "operators" then sets the weights of individual
+operators; the rest have a weight of 1.
+*/
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+type Grammar struct {
+	// Relative weights of the operators, indexed by operator (e.g.
+	// Weights[SIN]). The weights of CONST and the variables are ignored.
+	Weights [OPERATOR_COUNT]float64
+	// Relative odds of each kind of operator
+	VariableWeight float64
+	ConstantWeight float64
+	UnaryWeight    float64
+	BinaryWeight   float64
+	TernaryWeight  float64
+	// Constants are picked uniformly from [ConstMin, ConstMax).
+	ConstMin float64
+	ConstMax float64
+}
+
+// The grammar which is used if none is given: every operator is equally
+// likely, and constants are between 0 and 1. It must not be changed; use
+// NewGrammar to get a copy.
+var defaultGrammar = NewGrammar()
+
+// Returns a copy of the default grammar, which can be changed.
+func NewGrammar() *Grammar {
+	g := &Grammar{
+		VariableWeight: 1,
+		ConstantWeight: 1,
+		UnaryWeight:    1,
+		BinaryWeight:   1,
+		TernaryWeight:  1,
+		ConstMin:       0,
+		ConstMax:       1,
+	}
+	for op := range g.Weights {
+		if op != CONST {
+			g.Weights[op] = 1
+		}
+	}
+	return g
+}
+
+// Returns g, or the default grammar if g is nil.
+func (g *Grammar) orDefault() *Grammar {
+	if g == nil {
+		return defaultGrammar
+	}
+	return g
+}
+
+func (g *Grammar) Validate() error {
+	for op, w := range g.Weights {
+		if w < 0 {
+			return fmt.Errorf("weight of %s can't be negative", operatorNames[op])
+		}
+	}
+	if g.VariableWeight < 0 || g.ConstantWeight < 0 || g.UnaryWeight < 0 || g.BinaryWeight < 0 || g.TernaryWeight < 0 {
+		return fmt.Errorf("weights can't be negative")
+	}
+	if g.VariableWeight == 0 && g.ConstantWeight == 0 {
+		return fmt.Errorf("variables and constants can't both have a weight of 0")
+	}
+	if g.ConstMin > g.ConstMax {
+		return fmt.Errorf("constMin (%v) is greater than constMax (%v)", g.ConstMin, g.ConstMax)
+	}
+	return nil
+}
+
+// Returns a random index of weights, with probabilities proportional to the
+// weights. If all the weights are equal, this uses rng.Intn. Returns -1 if
+// all the weights are 0.
+func pickWeighted(rng *rand.Rand, weights []float64) int {
+	equal := true
+	total := 0.0
+	for _, w := range weights {
+		equal = equal && w == weights[0]
+		total += w
+	}
+	if total <= 0 {
+		return -1
+	}
+	if equal {
+		return rng.Intn(len(weights))
+	}
+	r := rng.Float64() * total
+	for i, w := range weights {
+		r -= w
+		if r < 0 && w > 0 {
+			return i
+		}
+	}
+	// Rounding error; pick the last operator which can be picked
+	for i := len(weights) - 1; ; i-- {
+		if weights[i] > 0 {
+			return i
+		}
+	}
+}
+
+func (g *Grammar) hasUnary() bool {
+	return g.UnaryWeight > 0 && pickable(g.Weights[FIRST_UNARY:FIRST_TERNARY])
+}
+
+func (g *Grammar) hasBinary() bool {
+	return g.BinaryWeight > 0 && pickable(g.Weights[FIRST_BINARY:FIRST_UNARY])
+}
+
+func (g *Grammar) hasTernary() bool {
+	return g.TernaryWeight > 0 && pickable(g.Weights[FIRST_TERNARY:])
+}
+
+func pickable(weights []float64) bool {
+	for _, w := range weights {
+		if w > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *Grammar) randomUnary(rng *rand.Rand) int {
+	return FIRST_UNARY + pickWeighted(rng, g.Weights[FIRST_UNARY:FIRST_TERNARY])
+}
+
+func (g *Grammar) randomBinary(rng *rand.Rand) int {
+	return FIRST_BINARY + pickWeighted(rng, g.Weights[FIRST_BINARY:FIRST_UNARY])
+}
+
+func (g *Grammar) randomTernary(rng *rand.Rand) int {
+	return FIRST_TERNARY + pickWeighted(rng, g.Weights[FIRST_TERNARY:])
+}
+
+func (g *Grammar) randomConstant(rng *rand.Rand) Operator {
+	return Operator{op: CONST, constant: g.ConstMin + rng.Float64()*(g.ConstMax-g.ConstMin)}
+}
+
+// Returns a random variable or constant.
+func (g *Grammar) randomTerminal(rng *rand.Rand, nvars int) Operator {
+	if nvars == 0 || pickWeighted(rng, []float64{g.ConstantWeight, g.VariableWeight}) == 0 {
+		return g.randomConstant(rng)
+	}
+	return Operator{op: FIRST_VAR + rng.Intn(nvars)}
+}
+
+// Returns the operators of a random function with the given length and number
+// of variables. The function might be a bit shorter if g has no unary
+// operators.
+func (g *Grammar) randomOperators(rng *rand.Rand, nvars int, length int) []Operator {
+	const (
+		variable = iota
+		constant
+		unary
+		binary
+		ternary
+	)
+	hasUnary, hasBinary, hasTernary := g.hasUnary(), g.hasBinary(), g.hasTernary()
+	variableWeight := g.VariableWeight
+	if nvars == 0 {
+		variableWeight = 0
+	}
+	operators := make([]Operator, length)
+	nsOnStack := 0
+	i := 0
+	for nsOnStack+i < length {
+		var operator Operator
+		var optype int
+		if nsOnStack == 0 {
+			// Pick a random variable (or a constant, if there are no variables)
+			optype = variable
+			if variableWeight == 0 {
+				optype = constant
+			}
+		} else {
+			weights := []float64{variableWeight, g.ConstantWeight, 0}
+			if hasUnary {
+				weights[unary] = g.UnaryWeight
+			}
+			if nsOnStack > 1 {
+				// Binary operators are possible
+				weights = append(weights, g.BinaryWeight)
+			}
+			if nsOnStack > 2 && hasTernary {
+				weights = append(weights, g.TernaryWeight)
+			}
+			if nsOnStack == 1 && !hasBinary {
+				// Nothing could combine another value with this one.
+				weights[variable], weights[constant] = 0, 0
+			}
+			optype = pickWeighted(rng, weights)
+			if optype < 0 {
+				// Only a terminal is left
+				break
+			}
+		}
+		switch optype {
+		case variable:
+			operator.op = FIRST_VAR + rng.Intn(nvars)
+			nsOnStack++
+		case constant:
+			operator = g.randomConstant(rng)
+			nsOnStack++
+		case unary:
+			operator.op = g.randomUnary(rng)
+		case binary:
+			operator.op = g.randomBinary(rng)
+			nsOnStack--
+		case ternary:
+			operator.op = g.randomTernary(rng)
+			nsOnStack -= 2
+		}
+		operators[i] = operator
+		i++
+	}
+
+	if nsOnStack+i == length && hasUnary {
+		// Add a unary operator
+		operators[i].op = g.randomUnary(rng)
+		i++
+	}
+
+	// Keep adding binary operators until nsOnStack == 1
+	for nsOnStack > 1 {
+		operators[i].op = g.randomBinary(rng)
+		nsOnStack--
+		i++
+	}
+	return operators[:i]
+}
+
+// Sets the weights of operators from a list like "sin=3,cos=3,+,*". Operators
+// without a weight get a weight of 1, and operators which aren't in the list
+// get a weight of 0.
+func (g *Grammar) SetOperators(list string) error {
+	var weights [OPERATOR_COUNT]float64
+	for _, item := range strings.Split(list, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, weight := item, 1.0
+		if i := strings.LastIndex(item, "="); i > 0 {
+			name = item[:i]
+			var err error
+			if weight, err = strconv.ParseFloat(item[i+1:], 64); err != nil {
+				return fmt.Errorf("invalid weight for %s: %q", name, item[i+1:])
+			}
+		}
+		op, err := operatorByName(name)
+		if err != nil {
+			return err
+		}
+		weights[op] = weight
+	}
+	g.Weights = weights
+	return nil
+}
+
+// Returns the operator with the given name (e.g. "sin" or "+").
+func operatorByName(name string) (int, error) {
+	for op, n := range operatorNames {
+		if op != CONST && n == name {
+			return op, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown operator %q (should be one of: %s)", name, strings.Join(operatorNames[CONST+1:], ", "))
+}
+
+// The JSON representation of a grammar
+type grammarFile struct {
+	Only      []string           `json:"only,omitempty"`
+	Operators map[string]float64 `json:"operators,omitempty"`
+	Variables *float64           `json:"variables,omitempty"`
+	Constants *float64           `json:"constants,omitempty"`
+	Unary     *float64           `json:"unary,omitempty"`
+	Binary    *float64           `json:"binary,omitempty"`
+	Ternary   *float64           `json:"ternary,omitempty"`
+	ConstMin  *float64           `json:"constMin,omitempty"`
+	ConstMax  *float64           `json:"constMax,omitempty"`
+}
+
+func (g *Grammar) MarshalJSON() ([]byte, error) {
+	file := grammarFile{
+		Operators: make(map[string]float64),
+		Variables: &g.VariableWeight,
+		Constants: &g.ConstantWeight,
+		Unary:     &g.UnaryWeight,
+		Binary:    &g.BinaryWeight,
+		Ternary:   &g.TernaryWeight,
+		ConstMin:  &g.ConstMin,
+		ConstMax:  &g.ConstMax,
+	}
+	for op, w := range g.Weights {
+		if op != CONST {
+			file.Operators[operatorNames[op]] = w
+		}
+	}
+	return json.Marshal(&file)
+}
+
+func (g *Grammar) UnmarshalJSON(data []byte) error {
+	var file grammarFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return err
+	}
+	h := NewGrammar()
+	if file.Only != nil {
+		if err := h.SetOperators(strings.Join(file.Only, ",")); err != nil {
+			return err
+		}
+	}
+	for name, w := range file.Operators {
+		op, err := operatorByName(name)
+		if err != nil {
+			return err
+		}
+		h.Weights[op] = w
+	}
+	fields := []struct {
+		value *float64
+		dest  *float64
+	}{
+		{file.Variables, &h.VariableWeight},
+		{file.Constants, &h.ConstantWeight},
+		{file.Unary, &h.UnaryWeight},
+		{file.Binary, &h.BinaryWeight},
+		{file.Ternary, &h.TernaryWeight},
+		{file.ConstMin, &h.ConstMin},
+		{file.ConstMax, &h.ConstMax},
+	}
+	for _, field := range fields {
+		if field.value != nil {
+			*field.dest = *field.value
+		}
+	}
+	if err := h.Validate(); err != nil {
+		return err
+	}
+	*g = *h
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// Checks that f is a valid postfix program: every operator has enough operands,
+// one value is left at the end, and every variable is less than f.nvars.
+func checkValid(t *testing.T, f *Function) {
+	t.Helper()
+	depth := 0
+	for i, op := range f.operators {
+		if op.op >= FIRST_VAR && op.op-FIRST_VAR >= f.nvars {
+			t.Fatalf("%v: operator %d is variable %d, but there are only %d", f, i, op.op-FIRST_VAR, f.nvars)
+		}
+		a := arity(op.op)
+		if depth < a {
+			t.Fatalf("%v: operator %d needs %d operands, but there are only %d", f, i, a, depth)
+		}
+		depth += 1 - a
+	}
+	if depth != 1 {
+		t.Fatalf("%v: %d values are left on the stack", f, depth)
+	}
+}
+
+func TestGenerateWithoutVariables(t *testing.T) {
+	variables := NewGrammar()
+	variables.VariableWeight = 10
+	noConstants := NewGrammar()
+	noConstants.ConstantWeight = 0
+	rng := rand.New(rand.NewSource(1))
+	for _, grammar := range []*Grammar{defaultGrammar, variables, noConstants} {
+		for i := 0; i < 200; i++ {
+			var f Function
+			f.GenerateWith(grammar, 0, 1+i%40, rng)
+			checkValid(t, &f)
+			f.Evaluate(nil)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Infix and LaTeX notation
+
+Infix writes functions the usual way, e.g. sin((x + y) * 0.5), with only the
+parentheses needed to keep the order of evaluation (so a + (b + c) keeps its
+parentheses, since floating point addition isn't associative). abs(a) is written
+as |a|, and all other operators are written as calls, like min(a, b), using the
+names from the text format, except that noise operators are written without
+the number of arguments (perlin(x, y) instead of perlin2(x, y)).
+
+LaTeX writes functions as LaTeX math, e.g. \sin\left(\left(x + y\right) \cdot
+0.5\right). sqrt, log, and pow are written with the absolute values they take,
+e.g. \sqrt{\left|x\right|}, and select is written with cases.
+*/
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Precedences
+const (
+	precSum     = iota + 1 // + -
+	precProduct            // * /
+	precAtom               // Variables, constants, calls, etc.
+)
+
+type notation struct {
+	names  []string
+	digits int
+	latex  bool
+}
+
+// Returns f in infix notation. Variable v is written as names[v], or as v0, v1,
+// etc. if there aren't enough names. Constants are rounded to digits
+// significant digits, or written exactly if digits is -1.
+func (f *Function) Infix(names []string, digits int) string {
+	s, _ := notation{names, digits, false}.write(f.tree())
+	return s
+}
+
+// Like Infix, but returns f as LaTeX math. The names should be LaTeX too.
+func (f *Function) LaTeX(names []string, digits int) string {
+	s, _ := notation{names, digits, true}.write(f.tree())
+	return s
+}
+
+func (n notation) parenthesize(s string) string {
+	if n.latex {
+		return `\left(` + s + `\right)`
+	}
+	return "(" + s + ")"
+}
+
+func (n notation) abs(s string) string {
+	if n.latex {
+		return `\left|` + s + `\right|`
+	}
+	return "|" + s + "|"
+}
+
+func (n notation) constant(c float64) (string, int) {
+	switch {
+	case math.IsNaN(c):
+		if n.latex {
+			return `\mathrm{NaN}`, precAtom
+		}
+		return "NaN", precAtom
+	case math.IsInf(c, 0):
+		s := "Inf"
+		if n.latex {
+			s = `\infty`
+		}
+		if c < 0 {
+			s = "-" + s
+		}
+		return s, precAtom
+	}
+	s := strconv.FormatFloat(c, 'g', n.digits, 64)
+	if i := strings.IndexByte(s, 'e'); n.latex && i >= 0 {
+		exponent, _ := strconv.Atoi(s[i+1:])
+		return fmt.Sprintf(`%s \times 10^{%d}`, s[:i], exponent), precProduct
+	}
+	return s, precAtom
+}
+
+// Returns the name of an operator written as a call.
+func (n notation) callName(op int) string {
+	name := operatorNames[op]
+	if isNoise(op) {
+		name = strings.TrimRight(name, "123")
+	}
+	if !n.latex {
+		return name
+	}
+	switch op {
+	case SIN, COS, TAN, MIN, MAX:
+		return `\` + name
+	}
+	return `\operatorname{` + name + `}`
+}
+
+// Returns e written in n, and its precedence.
+func (n notation) write(e *expr) (string, int) {
+	op := e.op.op
+	if op == CONST {
+		return n.constant(e.op.constant)
+	}
+	if op >= FIRST_VAR {
+		v := op - FIRST_VAR
+		if v < len(n.names) {
+			return n.names[v], precAtom
+		}
+		if n.latex {
+			return fmt.Sprintf("v_{%d}", v), precAtom
+		}
+		return fmt.Sprintf("v%d", v), precAtom
+	}
+	args := make([]string, len(e.args))
+	precs := make([]int, len(e.args))
+	for i, arg := range e.args {
+		args[i], precs[i] = n.write(arg)
+	}
+	// The argument of sqrt, log, or pow, in absolute value (LaTeX only)
+	absArg := func() string {
+		if e.args[0].op.op == ABS {
+			return args[0]
+		}
+		return n.abs(args[0])
+	}
+	var symbol string
+	var prec int
+	switch op {
+	case ADD:
+		symbol, prec = "+", precSum
+	case SUB:
+		symbol, prec = "-", precSum
+	case MUL:
+		symbol, prec = "*", precProduct
+		if n.latex {
+			symbol = `\cdot`
+		}
+	case DIV:
+		if n.latex {
+			return `\frac{` + args[0] + "}{" + args[1] + "}", precAtom
+		}
+		symbol, prec = "/", precProduct
+	case ABS:
+		return n.abs(args[0]), precAtom
+	}
+	if symbol != "" {
+		// Left operands need parentheses if they have lower precedence, and
+		// right operands if they don't have higher precedence or start with
+		// a minus sign.
+		if precs[0] < prec {
+			args[0] = n.parenthesize(args[0])
+		}
+		if precs[1] <= prec || strings.HasPrefix(args[1], "-") {
+			args[1] = n.parenthesize(args[1])
+		}
+		return args[0] + " " + symbol + " " + args[1], prec
+	}
+	if n.latex {
+		switch op {
+		case SQRT:
+			return `\sqrt{` + absArg() + "}", precAtom
+		case LOG:
+			return `\ln` + absArg(), precAtom
+		case POW:
+			return absArg() + "^{" + args[1] + "}", precAtom
+		case EXP:
+			return "e^{" + args[0] + "}", precAtom
+		case FLOOR:
+			return `\left\lfloor ` + args[0] + `\right\rfloor`, precAtom
+		case SELECT:
+			return `\begin{cases} ` + args[1] + ` & ` + args[0] + ` > 0 \\ ` +
+				args[2] + ` & \text{otherwise} \end{cases}`, precAtom
+		}
+	}
+	return n.callName(op) + n.parenthesize(strings.Join(args, ", ")), precAtom
+}
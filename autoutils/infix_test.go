@@ -0,0 +1,186 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var infixTests = []struct {
+	function string
+	digits   int
+	infix    string
+	latex    string
+}{
+	{"v0 v1 v2 - -", -1, "x - (y - z)", `x - \left(y - z\right)`},
+	{"v0 v1 - v2 -", -1, "x - y - z", "x - y - z"},
+	{"v0 v1 v2 + +", -1, "x + (y + z)", `x + \left(y + z\right)`},
+	{"v0 v1 v2 * /", -1, "x / (y * z)", `\frac{x}{y \cdot z}`},
+	{"v0 v1 * v2 /", -1, "x * y / z", `\frac{x \cdot y}{z}`},
+	{"v0 v1 + v2 *", -1, "(x + y) * z", `\left(x + y\right) \cdot z`},
+	{"v0 -0.5 -", -1, "x - (-0.5)", `x - \left(-0.5\right)`},
+	{"v0 -0.5 *", -1, "x * (-0.5)", `x \cdot \left(-0.5\right)`},
+	{"-0.5 v0 *", -1, "-0.5 * x", `-0.5 \cdot x`},
+	{"v0 1.5e-07 *", -1, "x * 1.5e-07", `x \cdot \left(1.5 \times 10^{-7}\right)`},
+	{"1.5e-07 v0 *", -1, "1.5e-07 * x", `1.5 \times 10^{-7} \cdot x`},
+	{"v0 -2.5e+20 +", -1, "x + (-2.5e+20)", `x + \left(-2.5 \times 10^{20}\right)`},
+	{"0.123456 v0 +", 3, "0.123 + x", "0.123 + x"},
+	{"v0 v1 pow", -1, "pow(x, y)", `\left|x\right|^{y}`},
+	{"v0 abs v1 v2 + pow", -1, "pow(|x|, y + z)", `\left|x\right|^{y + z}`},
+	{"v0 v1 v2 select", -1, "select(x, y, z)",
+		`\begin{cases} y & x > 0 \\ z & \text{otherwise} \end{cases}`},
+	{"v0 sqrt log", -1, "log(sqrt(x))", `\ln\left|\sqrt{\left|x\right|}\right|`},
+	{"v0 sin exp", -1, "exp(sin(x))", `e^{\sin\left(x\right)}`},
+	{"v0 v1 perlin2 floor", -1, "floor(perlin(x, y))", `\left\lfloor \operatorname{perlin}\left(x, y\right)\right\rfloor`},
+	{"v0 v1 v2 smoothstep", -1, "smoothstep(x, y, z)", `\operatorname{smoothstep}\left(x, y, z\right)`},
+	{"v3", -1, "v3", "v_{3}"},
+}
+
+func TestInfix(t *testing.T) {
+	names := []string{"x", "y", "z"}
+	for _, test := range infixTests {
+		f, err := ParseFunction("autoart1 nvars=4 " + test.function)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if infix := f.Infix(names, test.digits); infix != test.infix {
+			t.Errorf("%s: Infix gave %q, not %q", test.function, infix, test.infix)
+		}
+		if latex := f.LaTeX(names, test.digits); latex != test.latex {
+			t.Errorf("%s: LaTeX gave %q, not %q", test.function, latex, test.latex)
+		}
+	}
+}
+
+// A parser for Infix's output, for checking that it keeps the order of
+// evaluation
+type infixParser struct {
+	s string // The rest of the input
+}
+
+func (p *infixParser) consume(prefix string) bool {
+	if strings.HasPrefix(p.s, prefix) {
+		p.s = p.s[len(prefix):]
+		return true
+	}
+	return false
+}
+
+// Parses a sum (the lowest precedence).
+func (p *infixParser) sum() (*expr, error) {
+	return p.binary(p.product, " + ", ADD, " - ", SUB)
+}
+
+func (p *infixParser) product() (*expr, error) {
+	return p.binary(p.atom, " * ", MUL, " / ", DIV)
+}
+
+// Parses left-associative operators whose operands are parsed with operand.
+func (p *infixParser) binary(operand func() (*expr, error), symbol1 string, op1 int, symbol2 string, op2 int) (*expr, error) {
+	e, err := operand()
+	for err == nil {
+		op := op1
+		if !p.consume(symbol1) {
+			if !p.consume(symbol2) {
+				return e, nil
+			}
+			op = op2
+		}
+		var right *expr
+		right, err = operand()
+		e = opExpr(op, e, right)
+	}
+	return nil, err
+}
+
+func (p *infixParser) atom() (*expr, error) {
+	switch {
+	case p.consume("("):
+		e, err := p.sum()
+		if err == nil && !p.consume(")") {
+			err = fmt.Errorf("missing ) before %q", p.s)
+		}
+		return e, err
+	case p.consume("|"):
+		e, err := p.sum()
+		if err == nil && !p.consume("|") {
+			err = fmt.Errorf("missing | before %q", p.s)
+		}
+		return opExpr(ABS, e), err
+	}
+	end := strings.IndexAny(p.s, " ,()|")
+	if end == -1 {
+		end = len(p.s)
+	}
+	token := p.s[:end]
+	p.s = p.s[end:]
+	if c, err := strconv.ParseFloat(token, 64); err == nil {
+		return constExpr(c), nil
+	}
+	if !p.consume("(") {
+		v, err := strconv.Atoi(strings.TrimPrefix(token, "v"))
+		if err != nil || !strings.HasPrefix(token, "v") {
+			return nil, fmt.Errorf("bad variable %q", token)
+		}
+		return &expr{op: Operator{op: FIRST_VAR + v}}, nil
+	}
+	var args []*expr
+	for len(args) == 0 || p.consume(", ") {
+		arg, err := p.sum()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	if !p.consume(")") {
+		return nil, fmt.Errorf("missing ) before %q", p.s)
+	}
+	for op, name := range operatorNames {
+		if name == token || isNoise(op) && name == token+strconv.Itoa(len(args)) {
+			if arity(op) != len(args) {
+				return nil, fmt.Errorf("%s takes %d arguments, not %d", token, arity(op), len(args))
+			}
+			return opExpr(op, args...), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown operator %q", token)
+}
+
+func TestInfixRoundTrip(t *testing.T) {
+	for _, f := range testFunctions(t, 6, 300) {
+		infix := f.Infix(nil, -1)
+		p := infixParser{s: infix}
+		e, err := p.sum()
+		if err == nil && p.s != "" {
+			err = fmt.Errorf("unexpected %q", p.s)
+		}
+		if err != nil {
+			t.Fatalf("%v: couldn't parse %q: %v", &f, infix, err)
+		}
+		g := Function{nvars: f.nvars, seed: f.seed}
+		g.setTree(e)
+		if !sameFunction(&f, &g) {
+			t.Fatalf("%v was written as %q, which was parsed as %v", &f, infix, &g)
+		}
+	}
+}
@@ -0,0 +1,301 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Interval arithmetic
+
+Range works out an interval which contains every value a function can take
+when its variables are in given intervals, by working out an interval for
+each operator from the intervals of its operands. The interval always contains
+every value (apart from rounding errors and NaN), but it can be much bigger than
+the real range, because the same variable can appear in more than one place
+(e.g. x - x is taken to be between -1 and 1 if x is between 0 and 1). Splitting
+the variables' intervals into smaller pieces makes this much less of a problem.
+*/
+
+import (
+	"math"
+)
+
+type Interval struct {
+	Min float64
+	Max float64
+}
+
+var unbounded = Interval{math.Inf(-1), math.Inf(1)}
+
+// Returns whether neither end of i is infinite.
+func (i Interval) Bounded() bool {
+	return !math.IsInf(i.Min, 0) && !math.IsInf(i.Max, 0)
+}
+
+// Returns the smallest interval containing i and j.
+func (i Interval) Union(j Interval) Interval {
+	return Interval{math.Min(i.Min, j.Min), math.Max(i.Max, j.Max)}
+}
+
+// Returns the smallest interval containing all of values. If any of them are
+// NaN, it is unbounded.
+func span(values ...float64) Interval {
+	i := Interval{math.Inf(1), math.Inf(-1)}
+	for _, v := range values {
+		if math.IsNaN(v) {
+			return unbounded
+		}
+		i.Min, i.Max = math.Min(i.Min, v), math.Max(i.Max, v)
+	}
+	return i
+}
+
+// Like a * b, but 0 * infinity is 0, since the infinite end of an interval
+// is never reached.
+func mulBound(a float64, b float64) float64 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return a * b
+}
+
+func mulInterval(a Interval, b Interval) Interval {
+	return span(mulBound(a.Min, b.Min), mulBound(a.Min, b.Max), mulBound(a.Max, b.Min), mulBound(a.Max, b.Max))
+}
+
+func divInterval(a Interval, b Interval) Interval {
+	switch {
+	case b.Min > 0 || b.Max < 0:
+		return mulInterval(a, Interval{1 / b.Max, 1 / b.Min})
+	case b.Min == 0 && b.Max == 0:
+		return mulInterval(a, Interval{100, 100}) // Division by 0 is division by 0.01
+	case a.Min == 0 && a.Max == 0:
+		return a
+	}
+	return unbounded
+}
+
+func absInterval(a Interval) Interval {
+	switch {
+	case a.Min >= 0:
+		return a
+	case a.Max <= 0:
+		return Interval{-a.Max, -a.Min}
+	}
+	return Interval{0, math.Max(-a.Min, a.Max)}
+}
+
+// Returns whether a contains x0 + k period for some integer k.
+func containsPeriodic(a Interval, x0 float64, period float64) bool {
+	k := math.Ceil((a.Min - x0) / period)
+	return x0+k*period <= a.Max
+}
+
+func sinInterval(a Interval) Interval {
+	if !a.Bounded() || a.Max-a.Min >= 2*math.Pi {
+		return Interval{-1, 1}
+	}
+	i := span(math.Sin(a.Min), math.Sin(a.Max))
+	if containsPeriodic(a, math.Pi/2, 2*math.Pi) {
+		i.Max = 1
+	}
+	if containsPeriodic(a, -math.Pi/2, 2*math.Pi) {
+		i.Min = -1
+	}
+	return i
+}
+
+func applyBinaryInterval(op int, a Interval, b Interval) Interval {
+	switch op {
+	case ADD:
+		return span(a.Min+b.Min, a.Max+b.Max)
+	case SUB:
+		return span(a.Min-b.Max, a.Max-b.Min)
+	case MUL:
+		return mulInterval(a, b)
+	case DIV:
+		return divInterval(a, b)
+	case MIN:
+		return Interval{math.Min(a.Min, b.Min), math.Min(a.Max, b.Max)}
+	case MAX:
+		return Interval{math.Max(a.Min, b.Min), math.Max(a.Max, b.Max)}
+	case MOD:
+		// a mod b is between 0 and b, and is a if a already is.
+		switch {
+		case b.Min > 0 && a.Min >= 0 && a.Max < b.Min:
+			return a
+		case b.Min > 0:
+			return Interval{0, b.Max}
+		case b.Max < 0:
+			return Interval{b.Min, 0}
+		}
+		return Interval{math.Min(b.Min, 0), math.Max(b.Max, 0.01)}
+	case POW:
+		// |a|^b = exp(b log|a|)
+		a = absInterval(a)
+		if a.Min == 0 && b.Min < 0 {
+			return unbounded
+		}
+		p := mulInterval(Interval{math.Log(a.Min), math.Log(a.Max)}, b)
+		return span(math.Exp(p.Min), math.Exp(p.Max))
+	case ATAN2:
+		// Away from the negative x axis, atan2 is atan of one argument divided
+		// by the other, plus a constant.
+		switch {
+		case b.Min > 0:
+			q := divInterval(a, b)
+			return span(math.Atan(q.Min), math.Atan(q.Max))
+		case a.Min > 0:
+			q := divInterval(b, a)
+			return span(math.Pi/2-math.Atan(q.Max), math.Pi/2-math.Atan(q.Min))
+		case a.Max < 0:
+			q := divInterval(b, a)
+			return span(-math.Pi/2-math.Atan(q.Max), -math.Pi/2-math.Atan(q.Min))
+		}
+		return Interval{-math.Pi, math.Pi}
+	case STEP:
+		switch {
+		case b.Max < a.Min:
+			return Interval{0, 0}
+		case b.Min >= a.Max:
+			return Interval{1, 1}
+		}
+		return Interval{0, 1}
+	case PERLIN2, SIMPLEX2, VALUE2, WORLEY2:
+		return Interval{0, 1}
+	}
+	panic("Invalid binary operator!")
+}
+
+func applyUnaryInterval(op int, a Interval) Interval {
+	switch op {
+	case SQRT:
+		a = absInterval(a)
+		return Interval{math.Sqrt(a.Min), math.Sqrt(a.Max)}
+	case SIN:
+		return sinInterval(a)
+	case COS:
+		return sinInterval(span(a.Min+math.Pi/2, a.Max+math.Pi/2))
+	case TAN:
+		if !a.Bounded() || a.Max-a.Min >= math.Pi || containsPeriodic(a, math.Pi/2, math.Pi) {
+			return unbounded
+		}
+		return span(math.Tan(a.Min), math.Tan(a.Max))
+	case LOG:
+		a = absInterval(a)
+		return Interval{math.Log(a.Min), math.Log(a.Max)}
+	case EXP:
+		return Interval{math.Exp(a.Min), math.Exp(a.Max)}
+	case ABS:
+		return absInterval(a)
+	case FLOOR:
+		return Interval{math.Floor(a.Min), math.Floor(a.Max)}
+	case FRACT:
+		if a.Bounded() && math.Floor(a.Min) == math.Floor(a.Max) {
+			f := math.Floor(a.Min)
+			return Interval{a.Min - f, a.Max - f}
+		}
+		return Interval{0, 1}
+	case PERLIN1, VALUE1:
+		return Interval{0, 1}
+	}
+	panic("Invalid unary operator!")
+}
+
+func applyTernaryInterval(op int, a Interval, b Interval, c Interval) Interval {
+	switch op {
+	case SMOOTHSTEP:
+		return Interval{0, 1}
+	case SELECT:
+		switch {
+		case a.Min > 0:
+			return b
+		case a.Max <= 0:
+			return c
+		}
+		return b.Union(c)
+	case PERLIN3, SIMPLEX3, VALUE3, WORLEY3:
+		return Interval{0, 1}
+	}
+	panic("Invalid ternary operator!")
+}
+
+// Returns an interval containing every value of f when variable v is in
+// vars[v].
+func (f *Function) evaluateInterval(vars []Interval) Interval {
+	var stack []Interval
+	for _, op := range f.operators {
+		l := len(stack)
+		switch arity(op.op) {
+		case 0:
+			if op.op == CONST {
+				stack = append(stack, Interval{op.constant, op.constant})
+			} else {
+				stack = append(stack, vars[op.op-FIRST_VAR])
+			}
+		case 1:
+			stack[l-1] = applyUnaryInterval(op.op, stack[l-1])
+		case 2:
+			stack[l-2] = applyBinaryInterval(op.op, stack[l-2], stack[l-1])
+			stack = stack[:l-1]
+		case 3:
+			stack[l-3] = applyTernaryInterval(op.op, stack[l-3], stack[l-2], stack[l-1])
+			stack = stack[:l-2]
+		}
+		if i := stack[len(stack)-1]; math.IsNaN(i.Min) || math.IsNaN(i.Max) {
+			stack[len(stack)-1] = unbounded
+		}
+	}
+	return stack[0]
+}
+
+// Returns an estimate of the range of f when variable v is between
+// domain[v].Min and domain[v].Max. The domain of each variable is split into
+// the given number of pieces, and the range is worked out for every
+// combination of pieces, so a higher number of divisions gives a closer
+// estimate, but takes much longer for functions of many variables. See the
+// comment at the top of this file.
+func (f *Function) Range(domain []Interval, divisions int) Interval {
+	simplified := *f
+	simplified.Simplify()
+	vars := make([]Interval, len(domain))
+	result := Interval{math.Inf(1), math.Inf(-1)}
+	var divide func(v int)
+	divide = func(v int) {
+		if v == len(domain) {
+			result = result.Union(simplified.evaluateInterval(vars))
+			return
+		}
+		d := domain[v]
+		if d.Min == d.Max || !d.Bounded() {
+			vars[v] = d
+			divide(v + 1)
+			return
+		}
+		width := (d.Max - d.Min) / float64(divisions)
+		for i := 0; i < divisions; i++ {
+			vars[v] = Interval{d.Min + float64(i)*width, d.Min + float64(i+1)*width}
+			if i == divisions-1 {
+				vars[v].Max = d.Max
+			}
+			divide(v + 1)
+		}
+	}
+	divide(0)
+	return result
+}
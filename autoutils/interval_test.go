@@ -0,0 +1,59 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestRangeContainsValues(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	domain := []Interval{{-1, 1}, {0, 2}, {-0.5, 0.5}}
+	for i, f := range testFunctions(t, 4, 300) {
+		divisions := 1 + i%4
+		r := f.Range(domain, divisions)
+		for j := 0; j < 100; j++ {
+			vars := make([]float64, len(domain))
+			for v, d := range domain {
+				switch j % 3 {
+				case 0:
+					vars[v] = d.Min
+				case 1:
+					vars[v] = d.Max
+				}
+				if j >= 3 {
+					vars[v] = d.Min + rng.Float64()*(d.Max-d.Min)
+				}
+			}
+			value := f.Evaluate(vars)
+			if math.IsNaN(value) {
+				continue
+			}
+			// Allow for rounding errors.
+			tolerance := 1e-9 * math.Max(1, math.Abs(value))
+			if value < r.Min-tolerance || value > r.Max+tolerance {
+				t.Fatalf("function %d (%v) at %v is %v, which isn't in its range [%v, %v] (%d divisions)",
+					i, f.String(), vars, value, r.Min, r.Max, divisions)
+			}
+		}
+	}
+}
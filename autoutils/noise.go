@@ -0,0 +1,385 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Noise operators
+
+Perlin noise, simplex noise, value noise, and Worley (cellular) noise of one,
+two, or three arguments. The noise of a function depends on its noise seed,
+which is picked by the random number generator when the function is generated,
+so rendering a function always gives the same result. All of the noise
+operators return values between 0 and 1, and have features about 1/4 apart
+(their arguments are multiplied by noiseFrequency).
+*/
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+)
+
+const noiseFrequency = 4
+
+// Permutation and value tables made from a noise seed
+type noiseTables struct {
+	perm   [512]int
+	values [256]float64
+}
+
+func newNoiseTables(seed int64) *noiseTables {
+	t := new(noiseTables)
+	rng := rand.New(rand.NewSource(seed))
+	for i, p := range rng.Perm(256) {
+		t.perm[i] = p
+		t.perm[i+256] = p
+	}
+	for i := range t.values {
+		t.values[i] = rng.Float64()
+	}
+	return t
+}
+
+// Tables are cached, since making them takes much longer than evaluating a
+// function.
+var noiseCache struct {
+	sync.Mutex
+	tables map[int64]*noiseTables
+}
+
+const noiseCacheSize = 1024
+
+func noiseTablesFor(seed int64) *noiseTables {
+	noiseCache.Lock()
+	defer noiseCache.Unlock()
+	if t, ok := noiseCache.tables[seed]; ok {
+		return t
+	}
+	if len(noiseCache.tables) >= noiseCacheSize || noiseCache.tables == nil {
+		noiseCache.tables = make(map[int64]*noiseTables)
+	}
+	t := newNoiseTables(seed)
+	noiseCache.tables[seed] = t
+	return t
+}
+
+// Returns whether op is a noise operator.
+func isNoise(op int) bool {
+	switch op {
+	case PERLIN1, PERLIN2, PERLIN3, SIMPLEX2, SIMPLEX3,
+		VALUE1, VALUE2, VALUE3, WORLEY2, WORLEY3:
+		return true
+	}
+	return false
+}
+
+func (t *noiseTables) hash(i int) int {
+	return t.perm[i&255]
+}
+
+func (t *noiseTables) hash2(i int, j int) int {
+	return t.perm[t.hash(i)+j&255]
+}
+
+func (t *noiseTables) hash3(i int, j int, k int) int {
+	return t.perm[t.hash2(i, j)+k&255]
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t float64, a float64, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// Maps x from [-1, 1] to [0, 1].
+func unitRange(x float64) float64 {
+	return math.Max(0, math.Min(1, 0.5+0.5*x))
+}
+
+// Splits x into the integer below it and the rest.
+func split(x float64) (int, float64) {
+	f := math.Floor(x)
+	return int(f), x - f
+}
+
+func grad1(h int, x float64) float64 {
+	// Gradients between -1 and 1, but never 0
+	g := float64(h&7+1) / 8
+	if h&8 != 0 {
+		g = -g
+	}
+	return g * x
+}
+
+func grad2(h int, x float64, y float64) float64 {
+	switch h & 7 {
+	case 0:
+		return x + y
+	case 1:
+		return -x + y
+	case 2:
+		return x - y
+	case 3:
+		return -x - y
+	case 4:
+		return x
+	case 5:
+		return -x
+	case 6:
+		return y
+	}
+	return -y
+}
+
+func grad3(h int, x float64, y float64, z float64) float64 {
+	// Ken Perlin's 12 gradients (with 4 repeated)
+	h &= 15
+	u, v := y, z
+	if h < 8 {
+		u = x
+	}
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
+
+func (t *noiseTables) perlin1(x float64) float64 {
+	i, fx := split(x)
+	n := lerp(fade(fx), grad1(t.hash(i), fx), grad1(t.hash(i+1), fx-1))
+	return unitRange(2 * n)
+}
+
+func (t *noiseTables) perlin2(x float64, y float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	u, v := fade(fx), fade(fy)
+	n := lerp(v,
+		lerp(u, grad2(t.hash2(i, j), fx, fy), grad2(t.hash2(i+1, j), fx-1, fy)),
+		lerp(u, grad2(t.hash2(i, j+1), fx, fy-1), grad2(t.hash2(i+1, j+1), fx-1, fy-1)))
+	return unitRange(n)
+}
+
+func (t *noiseTables) perlin3(x float64, y float64, z float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	k, fz := split(z)
+	u, v, w := fade(fx), fade(fy), fade(fz)
+	corner := func(di int, dj int, dk int) float64 {
+		return grad3(t.hash3(i+di, j+dj, k+dk), fx-float64(di), fy-float64(dj), fz-float64(dk))
+	}
+	n := lerp(w,
+		lerp(v, lerp(u, corner(0, 0, 0), corner(1, 0, 0)), lerp(u, corner(0, 1, 0), corner(1, 1, 0))),
+		lerp(v, lerp(u, corner(0, 0, 1), corner(1, 0, 1)), lerp(u, corner(0, 1, 1), corner(1, 1, 1))))
+	return unitRange(n)
+}
+
+// Simplex noise, following Stefan Gustavson's "Simplex noise demystified"
+func (t *noiseTables) simplex2(x float64, y float64) float64 {
+	const f2 = 0.36602540378443865 // (sqrt(3) - 1) / 2
+	const g2 = 0.21132486540518713 // (3 - sqrt(3)) / 6
+	s := (x + y) * f2
+	i, j := int(math.Floor(x+s)), int(math.Floor(y+s))
+	u := float64(i+j) * g2
+	x0, y0 := x-(float64(i)-u), y-(float64(j)-u)
+	i1, j1 := 0, 1
+	if x0 > y0 {
+		i1, j1 = 1, 0
+	}
+	corners := [3][2]float64{
+		{x0, y0},
+		{x0 - float64(i1) + g2, y0 - float64(j1) + g2},
+		{x0 - 1 + 2*g2, y0 - 1 + 2*g2},
+	}
+	offsets := [3][2]int{{0, 0}, {i1, j1}, {1, 1}}
+	n := 0.0
+	for c, p := range corners {
+		r := 0.5 - p[0]*p[0] - p[1]*p[1]
+		if r > 0 {
+			r *= r
+			n += r * r * grad2(t.hash2(i+offsets[c][0], j+offsets[c][1]), p[0], p[1])
+		}
+	}
+	return unitRange(70 * n)
+}
+
+func (t *noiseTables) simplex3(x float64, y float64, z float64) float64 {
+	const f3 = 1.0 / 3
+	const g3 = 1.0 / 6
+	s := (x + y + z) * f3
+	i, j, k := int(math.Floor(x+s)), int(math.Floor(y+s)), int(math.Floor(z+s))
+	u := float64(i+j+k) * g3
+	x0, y0, z0 := x-(float64(i)-u), y-(float64(j)-u), z-(float64(k)-u)
+	// Find which of the six simplices we're in
+	var o1, o2 [3]int
+	switch {
+	case x0 >= y0 && y0 >= z0:
+		o1, o2 = [3]int{1, 0, 0}, [3]int{1, 1, 0}
+	case x0 >= y0 && x0 >= z0:
+		o1, o2 = [3]int{1, 0, 0}, [3]int{1, 0, 1}
+	case x0 >= y0:
+		o1, o2 = [3]int{0, 0, 1}, [3]int{1, 0, 1}
+	case y0 < z0:
+		o1, o2 = [3]int{0, 0, 1}, [3]int{0, 1, 1}
+	case x0 < z0:
+		o1, o2 = [3]int{0, 1, 0}, [3]int{0, 1, 1}
+	default:
+		o1, o2 = [3]int{0, 1, 0}, [3]int{1, 1, 0}
+	}
+	offsets := [4][3]int{{0, 0, 0}, o1, o2, {1, 1, 1}}
+	n := 0.0
+	for c, o := range offsets {
+		px := x0 - float64(o[0]) + float64(c)*g3
+		py := y0 - float64(o[1]) + float64(c)*g3
+		pz := z0 - float64(o[2]) + float64(c)*g3
+		r := 0.6 - px*px - py*py - pz*pz
+		if r > 0 {
+			r *= r
+			n += r * r * grad3(t.hash3(i+o[0], j+o[1], k+o[2]), px, py, pz)
+		}
+	}
+	return unitRange(32 * n)
+}
+
+func (t *noiseTables) value1(x float64) float64 {
+	i, fx := split(x)
+	return lerp(fade(fx), t.values[t.hash(i)], t.values[t.hash(i+1)])
+}
+
+func (t *noiseTables) value2(x float64, y float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	u, v := fade(fx), fade(fy)
+	return lerp(v,
+		lerp(u, t.values[t.hash2(i, j)], t.values[t.hash2(i+1, j)]),
+		lerp(u, t.values[t.hash2(i, j+1)], t.values[t.hash2(i+1, j+1)]))
+}
+
+func (t *noiseTables) value3(x float64, y float64, z float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	k, fz := split(z)
+	u, v, w := fade(fx), fade(fy), fade(fz)
+	corner := func(di int, dj int, dk int) float64 {
+		return t.values[t.hash3(i+di, j+dj, k+dk)]
+	}
+	return lerp(w,
+		lerp(v, lerp(u, corner(0, 0, 0), corner(1, 0, 0)), lerp(u, corner(0, 1, 0), corner(1, 1, 0))),
+		lerp(v, lerp(u, corner(0, 0, 1), corner(1, 0, 1)), lerp(u, corner(0, 1, 1), corner(1, 1, 1))))
+}
+
+// Distance to the nearest of a set of points, one in each unit square
+func (t *noiseTables) worley2(x float64, y float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	best := math.Inf(1)
+	for dj := -1; dj <= 1; dj++ {
+		for di := -1; di <= 1; di++ {
+			h := t.hash2(i+di, j+dj)
+			px := float64(di) + t.values[h] - fx
+			py := float64(dj) + t.values[t.perm[h+1]] - fy
+			best = math.Min(best, px*px+py*py)
+		}
+	}
+	// The nearest point is at most sqrt(2) away, since there is one in the
+	// same square.
+	return math.Sqrt(best / 2)
+}
+
+// Distance to the nearest of a set of points, one in each unit cube
+func (t *noiseTables) worley3(x float64, y float64, z float64) float64 {
+	i, fx := split(x)
+	j, fy := split(y)
+	k, fz := split(z)
+	best := math.Inf(1)
+	for dk := -1; dk <= 1; dk++ {
+		for dj := -1; dj <= 1; dj++ {
+			for di := -1; di <= 1; di++ {
+				h := t.hash3(i+di, j+dj, k+dk)
+				px := float64(di) + t.values[h] - fx
+				py := float64(dj) + t.values[t.perm[h+1]] - fy
+				pz := float64(dk) + t.values[t.perm[h+2]] - fz
+				best = math.Min(best, px*px+py*py+pz*pz)
+			}
+		}
+	}
+	return math.Sqrt(best / 3)
+}
+
+// Noise isn't defined for infinite or NaN arguments, or for arguments too big
+// to convert to ints.
+func noiseArg(x float64) float64 {
+	x *= noiseFrequency
+	if math.IsNaN(x) || math.Abs(x) > 1e9 {
+		return 0
+	}
+	return x
+}
+
+func (t *noiseTables) unary(op int, a float64) float64 {
+	a = noiseArg(a)
+	switch op {
+	case PERLIN1:
+		return t.perlin1(a)
+	case VALUE1:
+		return t.value1(a)
+	}
+	panic("Invalid noise operator!")
+}
+
+func (t *noiseTables) binary(op int, a float64, b float64) float64 {
+	a, b = noiseArg(a), noiseArg(b)
+	switch op {
+	case PERLIN2:
+		return t.perlin2(a, b)
+	case SIMPLEX2:
+		return t.simplex2(a, b)
+	case VALUE2:
+		return t.value2(a, b)
+	case WORLEY2:
+		return t.worley2(a, b)
+	}
+	panic("Invalid noise operator!")
+}
+
+func (t *noiseTables) ternary(op int, a float64, b float64, c float64) float64 {
+	a, b, c = noiseArg(a), noiseArg(b), noiseArg(c)
+	switch op {
+	case PERLIN3:
+		return t.perlin3(a, b, c)
+	case SIMPLEX3:
+		return t.simplex3(a, b, c)
+	case VALUE3:
+		return t.value3(a, b, c)
+	case WORLEY3:
+		return t.worley3(a, b, c)
+	}
+	panic("Invalid noise operator!")
+}
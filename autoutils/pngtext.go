@@ -0,0 +1,135 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+// Text chunks in PNG files
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"io"
+	"math"
+)
+
+const pngSignature = "\x89PNG\r\n\x1a\n"
+
+// Length of the signature and the IHDR chunk, which must come first
+const pngHeaderLength = 8 + 8 + 13 + 4
+
+// Longest text chunk ReadPNGText will read
+const maxPNGTextLength = 1 << 24
+
+// Encodes img as a PNG, with text stored in an iTXt chunk with the given
+// keyword. The keyword should be 1-79 Latin-1 characters, and the text can be
+// any UTF-8.
+func EncodePNGText(w io.Writer, img image.Image, keyword string, text string) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return err
+	}
+	encoded := buf.Bytes()
+	// keyword, compression flag, compression method, language, translated keyword
+	data := []byte(keyword + "\x00\x00\x00\x00\x00" + text)
+	chunk := make([]byte, 8, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	copy(chunk[4:], "iTXt")
+	chunk = append(chunk, data...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+
+	if _, err := w.Write(encoded[:pngHeaderLength]); err != nil {
+		return err
+	}
+	if _, err := w.Write(chunk); err != nil {
+		return err
+	}
+	_, err := w.Write(encoded[pngHeaderLength:])
+	return err
+}
+
+// Returns the text of the first uncompressed tEXt or iTXt chunk with the given
+// keyword in the PNG file read from r, or an error if there is no such chunk.
+func ReadPNGText(r io.Reader, keyword string) (string, error) {
+	signature := make([]byte, len(pngSignature))
+	if _, err := io.ReadFull(r, signature); err != nil {
+		return "", err
+	}
+	if string(signature) != pngSignature {
+		return "", fmt.Errorf("not a PNG file")
+	}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return "", err
+		}
+		length := binary.BigEndian.Uint32(header)
+		if length > math.MaxInt32 {
+			return "", fmt.Errorf("PNG chunk is too long (%d bytes)", length)
+		}
+		chunkType := string(header[4:])
+		crc := crc32.NewIEEE()
+		crc.Write(header[4:])
+		// Text which is too long to be ours is skipped, without reading it into memory.
+		text := (chunkType == "tEXt" || chunkType == "iTXt") && length <= maxPNGTextLength
+		var data []byte
+		if text {
+			data = make([]byte, length)
+			if _, err := io.ReadFull(r, data); err != nil {
+				return "", err
+			}
+			crc.Write(data)
+		} else if _, err := io.CopyN(crc, r, int64(length)); err != nil {
+			return "", err
+		}
+		if _, err := io.ReadFull(r, header[:4]); err != nil {
+			return "", err
+		}
+		if binary.BigEndian.Uint32(header[:4]) != crc.Sum32() {
+			return "", fmt.Errorf("wrong CRC in PNG %s chunk", chunkType)
+		}
+		if chunkType == "IEND" {
+			return "", fmt.Errorf("no %s text in PNG file", keyword)
+		}
+		if !text {
+			continue
+		}
+		fields := bytes.SplitN(data, []byte{0}, 2)
+		if len(fields) != 2 || string(fields[0]) != keyword {
+			continue
+		}
+		if chunkType == "tEXt" {
+			return string(fields[1]), nil
+		}
+		// compression flag, compression method, language\0, translated keyword\0, text
+		rest := fields[1]
+		if len(rest) < 2 || rest[0] != 0 {
+			continue
+		}
+		parts := bytes.SplitN(rest[2:], []byte{0}, 3)
+		if len(parts) != 3 {
+			continue
+		}
+		return string(parts[2]), nil
+	}
+}
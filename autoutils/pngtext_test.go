@@ -0,0 +1,71 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"strings"
+	"testing"
+)
+
+func encodeTestPNG(t *testing.T, text string) []byte {
+	var buf bytes.Buffer
+	if err := EncodePNGText(&buf, image.NewGray(image.Rect(0, 0, 4, 3)), "test", text); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestPNGText(t *testing.T) {
+	encoded := encodeTestPNG(t, "some text\nwith ünïcödé")
+	text, err := ReadPNGText(bytes.NewReader(encoded), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text != "some text\nwith ünïcödé" {
+		t.Errorf("read %q", text)
+	}
+	if _, err = ReadPNGText(bytes.NewReader(encoded), "other"); err == nil {
+		t.Error("read text with the wrong keyword")
+	}
+}
+
+func TestPNGTextErrors(t *testing.T) {
+	encoded := encodeTestPNG(t, "text")
+	// The iTXt chunk comes right after the header.
+	corrupted := append([]byte(nil), encoded...)
+	corrupted[pngHeaderLength+8+len("test")+5] ^= 1
+	if _, err := ReadPNGText(bytes.NewReader(corrupted), "test"); err == nil || !strings.Contains(err.Error(), "CRC") {
+		t.Errorf("wrong CRC: got error %v", err)
+	}
+
+	tooLong := append([]byte(nil), encoded...)
+	binary.BigEndian.PutUint32(tooLong[pngHeaderLength:], 0xfffffff0)
+	if _, err := ReadPNGText(bytes.NewReader(tooLong), "test"); err == nil {
+		t.Error("read a chunk which is too long")
+	}
+	// A text chunk which is longer than the file shouldn't be read into memory.
+	binary.BigEndian.PutUint32(tooLong[pngHeaderLength:], 0x7ffffff0)
+	if _, err := ReadPNGText(bytes.NewReader(tooLong), "test"); err == nil {
+		t.Error("read a chunk which is longer than the file")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Simplification
+
+Simplify rewrites a function to do less work. It folds constant subexpressions
+(e.g. 0.3 0.7 * sin becomes 0.19480...), applies algebraic identities (x * 1 is
+x, min(a, a) is a), and drops subexpressions whose values are never used (the
+branch of a select with a constant condition which isn't picked).
+
+Every rewrite gives exactly the same result as the original function for
+every input, including infinities, NaNs, and the sign of zero. Some identities,
+such as x - x = 0, are only true when x is finite, so they are only used when x
+is known to be finite (which variables aren't: they can be NaN or infinite).
+*/
+
+import (
+	"math"
+)
+
+// Returns whether e is always finite.
+func (e *expr) finite() bool {
+	switch e.op.op {
+	case CONST:
+		return !math.IsInf(e.op.constant, 0) && !math.IsNaN(e.op.constant)
+	case STEP, PERLIN1, PERLIN2, PERLIN3, SIMPLEX2, SIMPLEX3,
+		VALUE1, VALUE2, VALUE3, WORLEY2, WORLEY3:
+		// Always finite, whatever the operands are
+		return true
+	case SIN, COS, ATAN2, MIN, MAX, ABS, FLOOR, FRACT, SELECT:
+		// Finite if the operands are
+		for _, arg := range e.args {
+			if !arg.finite() {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func constExpr(c float64) *expr {
+	return &expr{op: Operator{op: CONST, constant: c}}
+}
+
+// Simplifies e, whose operands have already been simplified.
+func (e *expr) simplify(t *noiseTables) *expr {
+	if len(e.args) == 0 {
+		return e
+	}
+	allConst := true
+	for _, arg := range e.args {
+		allConst = allConst && arg.isConst()
+	}
+	if allConst {
+		return constExpr(e.fold(t))
+	}
+	a := e.args
+	switch e.op.op {
+	case MUL:
+		if a[1].isConstValue(1) {
+			return a[0]
+		}
+		if a[0].isConstValue(1) {
+			return a[1]
+		}
+	case DIV:
+		if a[1].isConstValue(1) {
+			return a[0]
+		}
+	case SUB:
+		if a[1].isConst() && math.Float64bits(a[1].op.constant) == 0 { // x - (+0)
+			return a[0]
+		}
+		if a[0].equal(a[1]) && a[0].finite() {
+			return constExpr(0)
+		}
+	case MIN, MAX:
+		if a[0].equal(a[1]) {
+			return a[0]
+		}
+	case STEP:
+		if a[0].equal(a[1]) {
+			return constExpr(1)
+		}
+	case SQRT, LOG:
+		// These take the absolute value of their operand anyways.
+		if a[0].op.op == ABS {
+			return &expr{op: e.op, args: a[0].args}
+		}
+	case POW:
+		if a[0].op.op == ABS {
+			return &expr{op: e.op, args: []*expr{a[0].args[0], a[1]}}
+		}
+	case ABS, FLOOR:
+		if a[0].op.op == e.op.op {
+			return a[0]
+		}
+	case SMOOTHSTEP:
+		if a[0].equal(a[1]) && a[0].finite() {
+			return &expr{op: Operator{op: STEP}, args: []*expr{a[0], a[2]}}
+		}
+	case SELECT:
+		if a[0].isConst() {
+			// Only one of the branches is ever used.
+			if a[0].op.constant > 0 {
+				return a[1]
+			}
+			return a[2]
+		}
+		if a[1].equal(a[2]) {
+			return a[1]
+		}
+	}
+	return e
+}
+
+func (e *expr) simplifyAll(t *noiseTables) *expr {
+	for i, arg := range e.args {
+		e.args[i] = arg.simplifyAll(t)
+	}
+	return e.simplify(t)
+}
+
+// Simplifies f, as described above. f gives exactly the same results
+// afterwards, but might be much shorter.
+func (f *Function) Simplify() {
+	f.setTree(f.tree().simplifyAll(f.noiseTables()))
+}
@@ -0,0 +1,103 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+/*
+Splitting
+
+When a function is evaluated over a grid (e.g. at every pixel of every frame of
+a video), parts of it often only depend on some of the variables. For example,
+in sin(x * 3) + y, sin(x * 3) is the same for every pixel in a column. Split
+finds these parts, so that they can be evaluated once and reused.
+*/
+
+// A set of variables. Variable v is in the set if bit v is set.
+type VarSet uint
+
+// Returns the set of variables e depends on.
+func (e *expr) vars() VarSet {
+	if e.op.op >= FIRST_VAR {
+		return 1 << uint(e.op.op-FIRST_VAR)
+	}
+	var set VarSet
+	for _, arg := range e.args {
+		set |= arg.vars()
+	}
+	return set
+}
+
+// Returns the set of variables f depends on.
+func (f *Function) Vars() VarSet {
+	simplified := *f
+	simplified.Simplify()
+	return simplified.tree().vars()
+}
+
+/*
+A function split into parts and the rest. Main takes
+Function.NVars() + len(Parts) variables: the variables of the original
+function, followed by the values of the parts. It gives exactly the same
+results as the original function, as long as variable NVars()+i is the value of
+Parts[i] (which take the same variables as the original function).
+*/
+type SplitFunction struct {
+	Main  Function
+	Parts []Function
+	// Sets[i] is the index (in the sets passed to Split) of the set which the
+	// variables of Parts[i] are in.
+	Sets []int
+}
+
+/*
+Splits off the biggest subexpressions of f which only depend on the variables
+in one of sets. If a subexpression fits in more than one set, the first one is
+used, so the sets should be ordered from the cheapest (the one whose parts need
+to be evaluated the fewest times) to the most expensive. Variables and
+constants on their own aren't split off, since there's nothing to save.
+*/
+func (f *Function) Split(sets []VarSet) SplitFunction {
+	simplified := *f
+	simplified.Simplify()
+	var h SplitFunction
+	var split func(e *expr) *expr
+	split = func(e *expr) *expr {
+		if len(e.args) == 0 {
+			return e
+		}
+		vars := e.vars()
+		for i, set := range sets {
+			if vars&^set == 0 {
+				part := Function{nvars: f.nvars, seed: f.seed}
+				part.setTree(e)
+				h.Parts = append(h.Parts, part)
+				h.Sets = append(h.Sets, i)
+				return &expr{op: Operator{op: FIRST_VAR + f.nvars + len(h.Parts) - 1}}
+			}
+		}
+		for i, arg := range e.args {
+			e.args[i] = split(arg)
+		}
+		return e
+	}
+	main := split(simplified.tree())
+	h.Main = Function{nvars: f.nvars + len(h.Parts), seed: f.seed}
+	h.Main.setTree(main)
+	return h
+}
@@ -0,0 +1,104 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package autoutils
+
+// Functions as expression trees
+
+import (
+	"math"
+)
+
+// A node of the expression tree of a function. The children are the operands
+// of op, in the order they are pushed onto the stack.
+type expr struct {
+	op   Operator
+	args []*expr
+}
+
+// Returns the expression tree of f.
+func (f *Function) tree() *expr {
+	stack := make([]*expr, 0, len(f.operators))
+	for _, op := range f.operators {
+		n := arity(op.op)
+		e := &expr{op: op}
+		if n > 0 {
+			e.args = append([]*expr(nil), stack[len(stack)-n:]...)
+			stack = stack[:len(stack)-n]
+		}
+		stack = append(stack, e)
+	}
+	return stack[0]
+}
+
+// Appends the operators of e to operators in postfix order.
+func (e *expr) postfix(operators []Operator) []Operator {
+	for _, arg := range e.args {
+		operators = arg.postfix(operators)
+	}
+	return append(operators, e.op)
+}
+
+// Sets the operators of f to those of e.
+func (f *Function) setTree(e *expr) {
+	f.operators = e.postfix(make([]Operator, 0, len(f.operators)))
+}
+
+func (e *expr) isConst() bool {
+	return e.op.op == CONST
+}
+
+// Returns whether e is the constant c.
+func (e *expr) isConstValue(c float64) bool {
+	return e.isConst() && e.op.constant == c
+}
+
+// Returns whether e and other always have the same value, because they are the
+// same expression.
+func (e *expr) equal(other *expr) bool {
+	if e.op.op != other.op.op || len(e.args) != len(other.args) {
+		return false
+	}
+	if e.isConst() && math.Float64bits(e.op.constant) != math.Float64bits(other.op.constant) {
+		return false
+	}
+	for i := range e.args {
+		if !e.args[i].equal(other.args[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the value of an operator whose operands are all constants.
+func (e *expr) fold(t *noiseTables) float64 {
+	a := make([]float64, len(e.args))
+	for i, arg := range e.args {
+		a[i] = arg.op.constant
+	}
+	switch len(a) {
+	case 1:
+		return applyUnary(e.op.op, a[0], t)
+	case 2:
+		return applyBinary(e.op.op, a[0], a[1], t)
+	case 3:
+		return applyTernary(e.op.op, a[0], a[1], a[2], t)
+	}
+	return e.op.constant
+}
@@ -23,19 +23,62 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/pommicket/autoart/autoart"
+	"github.com/pommicket/autoart/autoutils"
 	"io/ioutil"
-	"math/rand"
 	"os"
 	"os/exec"
 	"time"
 )
 
-func autoVideos(reader *bufio.Reader) error {
-	// Check if the user has ffmpeg
+// Check if the user has ffmpeg
+func checkFfmpeg() error {
 	cmd := exec.Command("ffmpeg", "-version")
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("Is ffmpeg installed? (%v)", err)
 	}
+	return nil
+}
+
+// Generates item n of the batch with the given seed, and saves it, along with
+// its manifest.
+func genVideo(width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, length int64, framerate int64, seed int64, n int64, filename string) error {
+	genome := autoart.RandomGenome(3, paletted, *conf, *pconf, autoutils.ItemRand(seed, n))
+	return saveVideo(genome, width, height, float64(length), int(framerate), seed, n, filename)
+}
+
+// Renders genome as a video, and saves it with its manifest embedded and next
+// to it.
+func saveVideo(genome *autoart.Genome, width int, height int, length float64, framerate int, seed int64, n int64, filename string) error {
+	manifest := autoart.NewVideoManifest(seed, n, width, height, length, framerate, genome)
+	err := genome.Video(width, height, length, framerate, filename, true, manifest)
+	if err != nil {
+		return err
+	}
+	return manifest.Save(manifestFilename(filename))
+}
+
+// Generates items first to first+number-1 of the batch with the given seed,
+// and puts them in dir.
+func batchedVideos(dir string, seed int64, first int64, number int64, width int, height int, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig, length int64, framerate int64) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	for i := first; i < first+number; i++ {
+		filename := fmt.Sprintf("%v/%09d.mp4", dir, i)
+		err = genVideo(width, height, paletted, conf, pconf, length, framerate, seed, i, filename)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("Done. Your videos are in this directory:", dir)
+	return nil
+}
+
+func autoVideos(reader *bufio.Reader) error {
+	if err := checkFfmpeg(); err != nil {
+		return err
+	}
 
 	tmp, err := ioutil.TempFile("", "frame*.png")
 	if err != nil {
@@ -60,11 +103,11 @@ Please enter 1, 2, or 3 (default: 1): `
 		return err
 	}
 	var conf autoart.Config
+	var pconf autoart.PaletteConfig
 	t := time.Now().UTC().UnixNano()
 	if option == 1 {
-		rand.Seed(t)
 		filename := fmt.Sprintf("autovideos%v.mp4", t)
-		err := autoart.GenerateVideo(1440, 900, conf, 10, 24, filename, true)
+		err := genVideo(1440, 900, false, &conf, &pconf, 10, 24, t, 0, filename)
 		fmt.Println("Generated video:", filename)
 		return err
 	}
@@ -86,74 +129,19 @@ Please enter 1, 2, or 3 (default: 1): `
 		return err
 	}
 	if option == 2 {
-		dir := fmt.Sprintf("autovideos%v", t)
-		err = os.MkdirAll(dir, 0700)
-		if err != nil {
-			return err
-		}
-		rand.Seed(t)
-		for i := int64(0); i < number; i++ {
-			err = autoart.GenerateVideo(int(width), int(height), conf,
-				float64(length), 24,
-				fmt.Sprintf("%v/%09d.mp4", dir, i), true)
-			if err != nil {
-				return err
-			}
-		}
-		fmt.Println("Done. Your videos are in this directory:", dir)
-		return nil
+		return batchedVideos(fmt.Sprintf("autovideos%v", t), t, 0, number, int(width), int(height), false, &conf, &pconf, length, 24)
 	}
 
 	framerate, err := readInt64(reader, "Frame rate (default: 24)? ", positive, 24)
 
-	var pconf autoart.PaletteConfig
-	paletted, err := readBool(reader, "Should a palette be used (y/n, default: n)? ", false)
+	// Advanced options
+	paletted, err := readOptions(reader, &conf, &pconf)
 	if err != nil {
 		return err
 	}
-
-	// Advanced options
-	if paletted {
-		err = readPaletteConf(reader, &pconf)
-		if err != nil {
-			return err
-		}
-	} else {
-		err = readConf(reader, &conf)
-		if err != nil {
-			return err
-		}
-	}
 	seed, err := readInt64(reader, "Random seed (default: current time)? ", func(i int64) bool {
 		return true
 	}, t)
 
-	dir := fmt.Sprintf("autovideos%v", seed)
-	err = os.MkdirAll(dir, 0700)
-	if err != nil {
-		return err
-	}
-	rand.Seed(seed)
-	if paletted {
-		for i := int64(0); i < number; i++ {
-			err = autoart.GenerateVideoPalette(int(width), int(height), pconf,
-				float64(length), int(framerate),
-				fmt.Sprintf("%v/%09d.mp4", dir, i), true)
-			if err != nil {
-				return err
-			}
-		}
-	} else {
-		for i := int64(0); i < number; i++ {
-			err = autoart.GenerateVideo(int(width), int(height), conf,
-				float64(length), int(framerate),
-				fmt.Sprintf("%v/%09d.mp4", dir, i), true)
-			if err != nil {
-				return err
-			}
-		}
-	}
-	fmt.Println("Done. Your videos are in this directory:", dir)
-	return nil
-
+	return batchedVideos(fmt.Sprintf("autovideos%v", seed), seed, 0, number, int(width), int(height), paletted, &conf, &pconf, length, framerate)
 }
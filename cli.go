@@ -0,0 +1,699 @@
+/*
+Copyright (C) 2019 Leo Tenenbaum
+
+This file is part of AutoArt.
+
+AutoArt is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+AutoArt is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with AutoArt.  If not, see <https://www.gnu.org/licenses/>.
+*/
+
+package main
+
+// Non-interactive command line interface, e.g.
+//   autoart image -width 640 -height 480 -colorspace hsv -count 10
+
+import (
+	"flag"
+	"fmt"
+	"github.com/pommicket/autoart/autoart"
+	"github.com/pommicket/autoart/autoutils"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const usage = `Usage: autoart [command] [flags]
+
+With no command, AutoArt asks you questions about what to make.
+
+Commands:
+  image       make images
+  video       make videos (needs ffmpeg)
+  audio       make audio
+  regenerate  make an image, video, or audio file again from its manifest
+              (the .json file next to it, or the file itself), e.g. at a
+              different size
+  formula     print the functions of a file as formulas, e.g. for captions
+  shader      write an image or video as a GLSL fragment shader
+  benchmark   time rendering with and without hoisting
+  help        show this message
+
+Run autoart [command] -h to see the flags for a command.
+`
+
+// Flags which every command has
+type batchFlags struct {
+	count int64
+	seed  int64
+	first int64
+	out   string
+}
+
+func addBatchFlags(fs *flag.FlagSet) *batchFlags {
+	b := new(batchFlags)
+	fs.Int64Var(&b.count, "count", 1, "how many to make")
+	fs.Int64Var(&b.seed, "seed", 0, "random seed (default: current time)")
+	fs.Int64Var(&b.first, "first", 0, "number of the first item in the batch; use with -seed and -count 1 to make one item of a batch again")
+	fs.StringVar(&b.out, "out", "", "output directory (default: autoimages/autovideos/autoaudio followed by the seed)")
+	return b
+}
+
+// Fills in the seed and output directory if they weren't given.
+func (b *batchFlags) resolve(fs *flag.FlagSet, prefix string) error {
+	seedSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			seedSet = true
+		}
+	})
+	if !seedSet {
+		b.seed = time.Now().UTC().UnixNano()
+	}
+	if b.out == "" {
+		b.out = fmt.Sprintf("%s%v", prefix, b.seed)
+	}
+	if b.count <= 0 {
+		return fmt.Errorf("-count must be positive")
+	}
+	if b.first < 0 {
+		return fmt.Errorf("-first can't be negative")
+	}
+	return nil
+}
+
+// Flags for autoart.Config and autoart.PaletteConfig
+type confFlags struct {
+	paletted       bool
+	colors         int
+	alpha          bool
+	functionLength int
+	colorSpace     string
+	rectifier      string
+	coords         string
+	operators      string
+	grammar        *autoutils.Grammar
+	preset         string
+	savePreset     string
+	viewport       *viewportFlags
+	// The preset's viewport, which the viewport flags change
+	presetViewport *autoart.Viewport
+}
+
+func addConfFlags(fs *flag.FlagSet) *confFlags {
+	c := new(confFlags)
+	fs.BoolVar(&c.paletted, "palette", false, "use a palette")
+	fs.IntVar(&c.colors, "colors", 10, "number of colors in the palette")
+	fs.BoolVar(&c.alpha, "alpha", false, "include an alpha channel")
+	fs.IntVar(&c.functionLength, "function-length", 40, "length of the functions")
+	fs.StringVar(&c.colorSpace, "colorspace", "rgb", "color space: "+strings.Join(autoart.ColorSpaceNames, ", "))
+	fs.StringVar(&c.rectifier, "rectifier", "mod", "what to do with out of range values: "+strings.Join(autoart.RectifierNames, ", ")+"; or one for each function, separated by commas")
+	fs.StringVar(&c.coords, "coords", "xy", "coordinate system: "+strings.Join(autoart.CoordinateSysNames, ", "))
+	fs.StringVar(&c.operators, "operators", "", "operators to use, with optional weights, e.g. sin=3,cos=3,+,* (default: all of them, equally likely)")
+	fs.StringVar(&c.preset, "preset", "", "preset to use (name or file); other flags override its options")
+	fs.StringVar(&c.savePreset, "save-preset", "", "save the options as a preset with this name (or file)")
+	c.viewport = addViewportFlags(fs)
+	return c
+}
+
+// Replaces the options which weren't given as flags with the ones in the preset.
+func (c *confFlags) applyPreset(fs *flag.FlagSet) error {
+	preset, err := loadPreset(c.preset)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	conf, pconf := &preset.Config, &preset.PaletteConfig
+	if !set["palette"] {
+		c.paletted = preset.Paletted
+	}
+	if !set["colors"] {
+		c.colors = pconf.NColors
+	}
+	if !set["alpha"] {
+		c.alpha = conf.Alpha || (c.paletted && pconf.Alpha)
+	}
+	if !set["function-length"] {
+		if c.paletted {
+			c.functionLength = pconf.FunctionLength
+		} else if conf.FunctionLength > 0 {
+			c.functionLength = conf.FunctionLength
+		}
+	}
+	if !set["colorspace"] {
+		c.colorSpace = autoart.ColorSpaceNames[conf.ColorSpace]
+	}
+	if !set["rectifier"] {
+		c.rectifier = autoart.RectifierNames[conf.Rectifier]
+		if conf.Rectifiers != nil {
+			names := make([]string, len(conf.Rectifiers))
+			for i, r := range conf.Rectifiers {
+				names[i] = autoart.RectifierNames[r]
+			}
+			c.rectifier = strings.Join(names, ",")
+		}
+	}
+	if !set["coords"] {
+		coords := conf.CoordinateSys
+		if c.paletted {
+			coords = pconf.CoordinateSys
+		}
+		c.coords = autoart.CoordinateSysNames[coords]
+	}
+	if c.paletted {
+		c.grammar, c.presetViewport = pconf.Grammar, pconf.Viewport
+	} else {
+		c.grammar, c.presetViewport = conf.Grammar, conf.Viewport
+	}
+	return nil
+}
+
+func (c *confFlags) resolve(fs *flag.FlagSet) (conf autoart.Config, pconf autoart.PaletteConfig, err error) {
+	if c.preset != "" {
+		if err = c.applyPreset(fs); err != nil {
+			return conf, pconf, err
+		}
+	}
+	if c.functionLength <= 0 {
+		return conf, pconf, fmt.Errorf("-function-length must be positive")
+	}
+	if c.colors <= 0 {
+		return conf, pconf, fmt.Errorf("-colors must be positive")
+	}
+	if conf.ColorSpace, err = autoart.ParseColorSpace(c.colorSpace); err != nil {
+		return conf, pconf, err
+	}
+	for _, name := range strings.Split(c.rectifier, ",") {
+		rectifier, err := autoart.ParseRectifier(strings.TrimSpace(name))
+		if err != nil {
+			return conf, pconf, err
+		}
+		conf.Rectifiers = append(conf.Rectifiers, rectifier)
+	}
+	conf.Rectifier = conf.Rectifiers[0]
+	if len(conf.Rectifiers) == 1 {
+		conf.Rectifiers = nil
+	}
+	if conf.CoordinateSys, err = autoart.ParseCoordinateSys(c.coords); err != nil {
+		return conf, pconf, err
+	}
+	if c.operators != "" {
+		// Keep the other settings of the preset's grammar, if there is one
+		grammar := autoutils.NewGrammar()
+		if c.grammar != nil {
+			*grammar = *c.grammar
+		}
+		if err = grammar.SetOperators(c.operators); err != nil {
+			return conf, pconf, err
+		}
+		if err = grammar.Validate(); err != nil {
+			return conf, pconf, err
+		}
+		c.grammar = grammar
+	}
+	if conf.Viewport, err = c.viewport.resolve(fs, c.presetViewport); err != nil {
+		return conf, pconf, err
+	}
+	conf.FunctionLength = c.functionLength
+	conf.Alpha = c.alpha
+	conf.Grammar = c.grammar
+	if !c.paletted {
+		if err = conf.Validate(); err != nil {
+			return conf, pconf, err
+		}
+	}
+	pconf.NColors = c.colors
+	pconf.Alpha = c.alpha
+	pconf.FunctionLength = c.functionLength
+	pconf.CoordinateSys = conf.CoordinateSys
+	pconf.Grammar = c.grammar
+	pconf.Viewport = conf.Viewport
+	if c.savePreset != "" {
+		filename, err := savePreset(c.savePreset, c.paletted, &conf, &pconf)
+		if err != nil {
+			return conf, pconf, err
+		}
+		fmt.Println("Saved preset:", filename)
+	}
+	return conf, pconf, nil
+}
+
+// Flags for autoart.Relief
+type reliefFlags struct {
+	relief autoart.Relief
+	on     bool
+}
+
+func addReliefFlags(fs *flag.FlagSet) *reliefFlags {
+	r := new(reliefFlags)
+	d := autoart.DefaultRelief()
+	fs.BoolVar(&r.on, "relief", false, "light the image as if one of its channels were a height, to make it look embossed")
+	fs.IntVar(&r.relief.Channel, "relief-channel", d.Channel, "which function is the height, starting from 0")
+	fs.Float64Var(&r.relief.Strength, "relief-strength", d.Strength, "how tall the relief is")
+	fs.Float64Var(&r.relief.Azimuth, "light-azimuth", d.Azimuth, "direction the light comes from, in degrees clockwise from the top")
+	fs.Float64Var(&r.relief.Elevation, "light-elevation", d.Elevation, "angle of the light above the image, in degrees")
+	fs.Float64Var(&r.relief.Ambient, "light-ambient", d.Ambient, "brightness of the parts facing away from the light, from 0 to 1")
+	return r
+}
+
+// Returns the relief, or nil if -relief wasn't given.
+func (r *reliefFlags) resolve() *autoart.Relief {
+	if !r.on {
+		return nil
+	}
+	return &r.relief
+}
+
+// Flags for autoart.Viewport
+type viewportFlags struct {
+	viewport autoart.Viewport
+	center   string
+}
+
+func addViewportFlags(fs *flag.FlagSet) *viewportFlags {
+	v := new(viewportFlags)
+	d := autoart.DefaultViewport()
+	fs.StringVar(&v.center, "center", fmt.Sprintf("%v,%v", d.CenterX, d.CenterY), "point to zoom in on, from 0,0 at the top left of the whole image to 1,1 at the bottom right")
+	fs.Float64Var(&v.viewport.Scale, "scale", d.Scale, "how much to zoom in (less than 1 zooms out)")
+	fs.Float64Var(&v.viewport.Rotation, "rotation", d.Rotation, "how far to turn the image clockwise, in degrees")
+	fs.BoolVar(&v.viewport.PreserveAspect, "preserve-aspect", d.PreserveAspect, "don't stretch the coordinates to fit the shape of the image")
+	return v
+}
+
+// Returns base (or the default viewport, if base is nil) with the viewport flags
+// which were given changed, or base itself if none of them were given.
+func (v *viewportFlags) resolve(fs *flag.FlagSet, base *autoart.Viewport) (*autoart.Viewport, error) {
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if !set["center"] && !set["scale"] && !set["rotation"] && !set["preserve-aspect"] {
+		return base, nil
+	}
+	viewport := *autoart.DefaultViewport()
+	if base != nil {
+		viewport = *base
+	}
+	if set["center"] {
+		var x, y float64
+		if _, err := fmt.Sscanf(v.center, "%g,%g", &x, &y); err != nil {
+			return nil, fmt.Errorf("-center should look like 0.5,0.5, not %s", v.center)
+		}
+		viewport.CenterX, viewport.CenterY = x, y
+	}
+	if set["scale"] {
+		viewport.Scale = v.viewport.Scale
+	}
+	if set["rotation"] {
+		viewport.Rotation = v.viewport.Rotation
+	}
+	if set["preserve-aspect"] {
+		viewport.PreserveAspect = v.viewport.PreserveAspect
+	}
+	if err := viewport.Validate(); err != nil {
+		return nil, err
+	}
+	return &viewport, nil
+}
+
+func positiveFlags(flags map[string]int64) error {
+	for name, value := range flags {
+		if value <= 0 {
+			return fmt.Errorf("-%s must be positive", name)
+		}
+	}
+	return nil
+}
+
+func imageCommand(args []string) error {
+	fs := flag.NewFlagSet("image", flag.ExitOnError)
+	width := fs.Int64("width", 1920, "width in pixels")
+	height := fs.Int64("height", 1080, "height in pixels")
+	filter := fs.Bool("filter", false, "throw out boring images (flat colors, gradients, noise)")
+	batch := addBatchFlags(fs)
+	cf := addConfFlags(fs)
+	rf := addReliefFlags(fs)
+	fs.Parse(args)
+	if err := batch.resolve(fs, "autoimages"); err != nil {
+		return err
+	}
+	if err := positiveFlags(map[string]int64{"width": *width, "height": *height}); err != nil {
+		return err
+	}
+	conf, pconf, err := cf.resolve(fs)
+	if err != nil {
+		return err
+	}
+	var qualityFilter *autoart.QualityFilter
+	if *filter {
+		qualityFilter = autoart.DefaultQualityFilter()
+		if !cf.paletted && conf.Rectifier == autoart.NORMALIZE && conf.Rectifiers == nil {
+			// Only keep functions whose ranges can be normalized
+			qualityFilter.Thresholds = append(qualityFilter.Thresholds,
+				autoart.Threshold{Scorer: autoart.UnboundedFraction, Min: 0, Max: 0})
+		}
+	}
+	return batchedImages(batch.out, batch.seed, batch.first, batch.count,
+		int(*width), int(*height), cf.paletted, &conf, &pconf, qualityFilter, rf.resolve())
+}
+
+func videoCommand(args []string) error {
+	fs := flag.NewFlagSet("video", flag.ExitOnError)
+	width := fs.Int64("width", 1440, "width in pixels")
+	height := fs.Int64("height", 900, "height in pixels")
+	length := fs.Int64("length", 10, "length in seconds")
+	framerate := fs.Int64("framerate", 24, "frames per second")
+	batch := addBatchFlags(fs)
+	cf := addConfFlags(fs)
+	fs.Parse(args)
+	if err := batch.resolve(fs, "autovideos"); err != nil {
+		return err
+	}
+	err := positiveFlags(map[string]int64{"width": *width, "height": *height,
+		"length": *length, "framerate": *framerate})
+	if err != nil {
+		return err
+	}
+	conf, pconf, err := cf.resolve(fs)
+	if err != nil {
+		return err
+	}
+	if err = checkFfmpeg(); err != nil {
+		return err
+	}
+	return batchedVideos(batch.out, batch.seed, batch.first, batch.count,
+		int(*width), int(*height), cf.paletted, &conf, &pconf, *length, *framerate)
+}
+
+func audioCommand(args []string) error {
+	fs := flag.NewFlagSet("audio", flag.ExitOnError)
+	length := fs.Int64("length", 60, "length in seconds")
+	sampleRate := fs.Int64("samplerate", 44100, "samples per second")
+	functionLength := fs.Int64("function-length", 80, "length of the function")
+	rectifierName := fs.String("rectifier", "mod", "what to do with out of range values: "+strings.Join(autoart.RectifierNames, ", "))
+	batch := addBatchFlags(fs)
+	fs.Parse(args)
+	if err := batch.resolve(fs, "autoaudio"); err != nil {
+		return err
+	}
+	err := positiveFlags(map[string]int64{"length": *length,
+		"samplerate": *sampleRate, "function-length": *functionLength})
+	if err != nil {
+		return err
+	}
+	rectifier, err := autoart.ParseRectifier(*rectifierName)
+	if err != nil {
+		return err
+	}
+	return generateAudio(batch.out, batch.seed, batch.first, batch.count,
+		*length, *sampleRate, *functionLength, rectifier)
+}
+
+// Returns the value of flag if it was given, otherwise def.
+func orDefault(flag int64, def int64) int64 {
+	if flag > 0 {
+		return flag
+	}
+	return def
+}
+
+// Loads a manifest (.json), or extracts it from an image, video, or audio file.
+func loadManifest(filename string) (*autoart.Manifest, error) {
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		return autoart.LoadManifest(filename)
+	}
+	return autoart.ExtractManifest(filename)
+}
+
+func regenerateCommand(args []string) error {
+	fs := flag.NewFlagSet("regenerate", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: autoart regenerate [flags] file")
+		fmt.Fprintln(fs.Output(), "file is a manifest (.json), or an image, video, or audio file made by AutoArt.")
+		fs.PrintDefaults()
+	}
+	kind := fs.String("as", "", "what to make: image, video, or audio (default: the same as the manifest)")
+	width := fs.Int64("width", 0, "width in pixels (default: the same as the manifest)")
+	height := fs.Int64("height", 0, "height in pixels (default: the same as the manifest)")
+	length := fs.Float64("length", 0, "length in seconds (default: the same as the manifest, or 10)")
+	framerate := fs.Int64("framerate", 0, "frames per second (default: the same as the manifest, or 24)")
+	sampleRate := fs.Int64("samplerate", 0, "samples per second (default: the same as the manifest)")
+	t := fs.Float64("time", 0, "time at which to render a video's functions as an image (default: the same as the manifest)")
+	out := fs.String("out", "", "output file (default: the name of the manifest, followed by -regenerated)")
+	rf := addReliefFlags(fs)
+	vf := addViewportFlags(fs)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("regenerate needs exactly one file")
+	}
+	manifest, err := loadManifest(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *kind == "" {
+		*kind = manifest.Kind
+	}
+	if (*kind == autoart.KindAudio) != (manifest.Kind == autoart.KindAudio) {
+		return fmt.Errorf("can't make %s from a manifest for %s", *kind, manifest.Kind)
+	}
+	extensions := map[string]string{
+		autoart.KindImage: ".png",
+		autoart.KindVideo: ".mp4",
+		autoart.KindAudio: ".wav",
+	}
+	extension, ok := extensions[*kind]
+	if !ok {
+		return fmt.Errorf("-as should be image, video, or audio, not %s", *kind)
+	}
+	filename := *out
+	if filename == "" {
+		filename = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + "-regenerated" + extension
+	}
+	given := map[string]int64{"width": *width, "height": *height,
+		"framerate": *framerate, "samplerate": *sampleRate}
+	for name, value := range given {
+		if value < 0 {
+			return fmt.Errorf("-%s must be positive", name)
+		}
+	}
+	if *length < 0 {
+		return fmt.Errorf("-length must be positive")
+	}
+	timeSet := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "time" {
+			timeSet = true
+		}
+	})
+	if !timeSet {
+		*t = manifest.Time
+	}
+
+	seconds := manifest.Length
+	if seconds <= 0 {
+		seconds = 10
+	}
+	if *length > 0 {
+		seconds = *length
+	}
+	if *kind == autoart.KindAudio {
+		options := manifest.Options
+		if options == nil {
+			options = new(autoart.Preset)
+		}
+		err = saveAudio(&manifest.Functions[0], seconds,
+			orDefault(*sampleRate, int64(manifest.SampleRate)),
+			int64(options.Config.FunctionLength), options.Config.Rectifier,
+			manifest.Seed, manifest.Item, filename)
+		if err != nil {
+			return err
+		}
+		fmt.Println("Generated audio:", filename)
+		return nil
+	}
+
+	genome, err := manifest.Genome()
+	if err != nil {
+		return fmt.Errorf("manifest %s: %v", fs.Arg(0), err)
+	}
+	viewport := genome.Config.Viewport
+	if genome.Paletted {
+		viewport = genome.PaletteConfig.Viewport
+	}
+	if viewport, err = vf.resolve(fs, viewport); err != nil {
+		return err
+	}
+	genome.Config.Viewport, genome.PaletteConfig.Viewport = viewport, viewport
+	w := int(orDefault(*width, int64(manifest.Width)))
+	h := int(orDefault(*height, int64(manifest.Height)))
+	if *kind == autoart.KindImage {
+		relief := rf.resolve()
+		if relief == nil && manifest.Kind == autoart.KindImage {
+			relief = manifest.Relief
+		}
+		if err = saveImage(genome, w, h, *t, relief, manifest.Seed, manifest.Item, filename); err != nil {
+			return err
+		}
+		fmt.Println("Generated an image:", filename)
+		return nil
+	}
+	if len(genome.Functions) > 0 && genome.Functions[0].NVars() < 3 {
+		fmt.Println("Warning: these functions don't depend on time, so the video won't move.")
+	}
+	if err = checkFfmpeg(); err != nil {
+		return err
+	}
+	fps := int64(manifest.Framerate)
+	if fps <= 0 {
+		fps = 24
+	}
+	fps = orDefault(*framerate, fps)
+	err = saveVideo(genome, w, h, seconds, int(fps), manifest.Seed, manifest.Item, filename)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Generated video:", filename)
+	return nil
+}
+
+func formulaCommand(args []string) error {
+	fs := flag.NewFlagSet("formula", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: autoart formula [flags] file")
+		fmt.Fprintln(fs.Output(), "file is a manifest (.json), or an image, video, or audio file made by AutoArt.")
+		fs.PrintDefaults()
+	}
+	latex := fs.Bool("latex", false, "write the formulas in LaTeX")
+	digits := fs.Int("digits", 4, "significant digits of constants (-1 for all of them)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("formula needs exactly one file")
+	}
+	if *digits == 0 || *digits < -1 {
+		return fmt.Errorf("-digits must be positive or -1")
+	}
+	manifest, err := loadManifest(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	formulas, err := manifest.Formulas(*latex, *digits)
+	if err != nil {
+		return err
+	}
+	for _, formula := range formulas {
+		fmt.Println(formula)
+	}
+	return nil
+}
+
+func shaderCommand(args []string) error {
+	fs := flag.NewFlagSet("shader", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: autoart shader [flags] file")
+		fmt.Fprintln(fs.Output(), "file is a manifest (.json), or an image or video file made by AutoArt.")
+		fs.PrintDefaults()
+	}
+	shadertoy := fs.Bool("shadertoy", false, "write the shader so that it can be pasted into Shadertoy")
+	out := fs.String("out", "", "output file (default: standard output)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("shader needs exactly one file")
+	}
+	manifest, err := loadManifest(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	genome, err := manifest.Genome()
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		return genome.WriteShader(os.Stdout, manifest.Width, manifest.Height, manifest.Time, *shadertoy)
+	}
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err = genome.WriteShader(file, manifest.Width, manifest.Height, manifest.Time, *shadertoy); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func benchmarkCommand(args []string) error {
+	fs := flag.NewFlagSet("benchmark", flag.ExitOnError)
+	width := fs.Int64("width", 640, "width in pixels")
+	height := fs.Int64("height", 360, "height in pixels")
+	frames := fs.Int64("frames", 12, "number of video frames to render for each genome")
+	count := fs.Int64("count", 10, "number of random genomes to render")
+	seed := fs.Int64("seed", 0, "random seed")
+	cf := addConfFlags(fs)
+	fs.Parse(args)
+	err := positiveFlags(map[string]int64{"width": *width, "height": *height,
+		"frames": *frames, "count": *count})
+	if err != nil {
+		return err
+	}
+	conf, pconf, err := cf.resolve(fs)
+	if err != nil {
+		return err
+	}
+	genomes := make([]*autoart.Genome, *count)
+	for i := range genomes {
+		rng := autoutils.ItemRand(*seed, int64(i))
+		genomes[i] = autoart.RandomGenome(3, cf.paletted, conf, pconf, rng)
+	}
+	times, err := autoart.TimeHoisting(genomes, int(*width), int(*height), *frames)
+	if err != nil {
+		return fmt.Errorf("%v (seed %d)", err, *seed)
+	}
+	report := func(what string, without time.Duration, with time.Duration) {
+		fmt.Printf("%s: %v without hoisting, %v with hoisting (%.2fx as fast)\n",
+			what, without.Round(time.Millisecond), with.Round(time.Millisecond),
+			without.Seconds()/with.Seconds())
+	}
+	report(fmt.Sprintf("%d images", len(genomes)), times.Images, times.HoistedImages)
+	report(fmt.Sprintf("%d video frames", int64(len(genomes))*(*frames)), times.Video, times.HoistedVideo)
+	return nil
+}
+
+func runCommand(args []string) error {
+	switch args[0] {
+	case "image":
+		return imageCommand(args[1:])
+	case "video":
+		return videoCommand(args[1:])
+	case "audio":
+		return audioCommand(args[1:])
+	case "regenerate":
+		return regenerateCommand(args[1:])
+	case "formula":
+		return formulaCommand(args[1:])
+	case "shader":
+		return shaderCommand(args[1:])
+	case "benchmark":
+		return benchmarkCommand(args[1:])
+	case "help", "-h", "-help", "--help":
+		fmt.Print(usage)
+		return nil
+	}
+	fmt.Fprint(os.Stderr, usage)
+	return fmt.Errorf("unknown command: %s", args[0])
+}
@@ -25,6 +25,8 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/pommicket/autoart/autoart"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 )
@@ -81,6 +83,109 @@ func readBool(reader *bufio.Reader, prompt string, def bool) (bool, error) {
 	}
 }
 
+// Reads a line from the reader, after giving the user the given prompt.
+// Leading and trailing whitespace is removed.
+func readString(reader *bufio.Reader, prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// Returns the directory where named presets are saved.
+func presetDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "autoart", "presets"), nil
+}
+
+// Returns the file for a preset. If name looks like a file name (it contains
+// a slash or ends in .json), it is used as is. Otherwise, it's the name of a
+// preset in presetDir.
+func presetFilename(name string) (string, error) {
+	if strings.ContainsAny(name, `/\`) || strings.HasSuffix(name, ".json") {
+		return name, nil
+	}
+	dir, err := presetDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+".json"), nil
+}
+
+func loadPreset(name string) (*autoart.Preset, error) {
+	filename, err := presetFilename(name)
+	if err != nil {
+		return nil, err
+	}
+	return autoart.LoadPreset(filename)
+}
+
+// Saves a preset, returning the name of the file it was saved to.
+func savePreset(name string, paletted bool, conf *autoart.Config, pconf *autoart.PaletteConfig) (string, error) {
+	filename, err := presetFilename(name)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return "", err
+	}
+	name = strings.TrimSuffix(filepath.Base(name), ".json")
+	preset := autoart.Preset{Name: name, Paletted: paletted, Config: *conf, PaletteConfig: *pconf}
+	return filename, preset.Save(filename)
+}
+
+// Reads the advanced options, either from a preset or by asking about each
+// one, and offers to save them as a preset.
+func readOptions(reader *bufio.Reader, conf *autoart.Config, pconf *autoart.PaletteConfig) (paletted bool, err error) {
+	for {
+		name, err := readString(reader, "Preset to use (name or file, leave blank to choose the options yourself)? ")
+		if err != nil {
+			return false, err
+		}
+		if name == "" {
+			break
+		}
+		preset, err := loadPreset(name)
+		if err != nil {
+			fmt.Println("Couldn't load preset:", err)
+			continue
+		}
+		*conf, *pconf = preset.Config, preset.PaletteConfig
+		return preset.Paletted, nil
+	}
+
+	paletted, err = readBool(reader, "Should a palette be used (y/n, default: n)? ", false)
+	if err != nil {
+		return false, err
+	}
+	if paletted {
+		err = readPaletteConf(reader, pconf)
+	} else {
+		err = readConf(reader, conf)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	name, err := readString(reader, "Save these options as a preset (enter a name, or leave blank)? ")
+	if err != nil {
+		return false, err
+	}
+	if name != "" {
+		filename, err := savePreset(name, paletted, conf, pconf)
+		if err != nil {
+			return false, err
+		}
+		fmt.Println("Saved preset:", filename)
+	}
+	return paletted, nil
+}
+
 // Reads an autoart.Config
 func readConf(reader *bufio.Reader, conf *autoart.Config) error {
 	positive := func(i int64) bool { return i > 0 }
@@ -94,8 +199,12 @@ func readConf(reader *bufio.Reader, conf *autoart.Config) error {
 3. CMYK
 4. HSV
 5. YCbCr
-Please enter a number between 1 and 5 (default: 1): `, func(i int64) bool {
-		return i >= 1 && i <= 5
+6. HSL
+7. CIELAB
+8. OKLab
+9. OKLCh (lightness, chroma, and hue; usually the nicest)
+Please enter a number between 1 and 9 (default: 1): `, func(i int64) bool {
+		return i >= 1 && i <= 9
 	}, 1)
 
 	if err != nil {
@@ -110,19 +219,19 @@ Please enter a number between 1 and 5 (default: 1): `, func(i int64) bool {
 1. Modulo
 2. Clamp
 3. Sigmoid
-Please enter 1, 2, or 3 (default: 1): `, func(i int64) bool {
-		return i >= 1 && i <= 3
+4. Normalize (stretch the range of each function to fit)
+5. Mirror (like modulo, but without sudden jumps)
+6. Tanh
+7. Sine (like mirror, but smooth)
+8. Percentile (stretch the values of each function to fit, after sampling them)
+Please enter a number from 1 to 8 (default: 1): `, func(i int64) bool {
+		return i >= 1 && i <= 8
 	}, 1)
 	if err != nil {
 		return err
 	}
 
-	coords, err := readInt64(reader, `Which coordinate system should be used?
-1. x, y
-2. r, theta
-Please enter 1 or 2 (default: 1): `, func(i int64) bool {
-		return i >= 1 && i <= 2
-	}, 1)
+	coords, err := readCoordinateSys(reader)
 	if err != nil {
 		return err
 	}
@@ -135,6 +244,21 @@ Please enter 1 or 2 (default: 1): `, func(i int64) bool {
 	return nil
 }
 
+// Asks the user which coordinate system (built-in or registered) to use, and
+// returns its number plus one.
+func readCoordinateSys(reader *bufio.Reader) (int64, error) {
+	var prompt strings.Builder
+	prompt.WriteString("Which coordinate system should be used?\n")
+	for i, description := range autoart.CoordinateSysDescriptions {
+		fmt.Fprintf(&prompt, "%d. %s\n", i+1, description)
+	}
+	n := int64(len(autoart.CoordinateSysDescriptions))
+	fmt.Fprintf(&prompt, "Please enter a number between 1 and %d (default: 1): ", n)
+	return readInt64(reader, prompt.String(), func(i int64) bool {
+		return i >= 1 && i <= n
+	}, 1)
+}
+
 func readPaletteConf(reader *bufio.Reader, conf *autoart.PaletteConfig) error {
 	positive := func(i int64) bool { return i > 0 }
 	ncolors, err := readInt64(reader, "How many colors do you want (default: 10)? ", positive, 10)
@@ -149,12 +273,7 @@ func readPaletteConf(reader *bufio.Reader, conf *autoart.PaletteConfig) error {
 	if err != nil {
 		return err
 	}
-	coords, err := readInt64(reader, `Which coordinate system should be used?
-1. x, y
-2. r, theta
-Please enter 1 or 2 (default: 1): `, func(i int64) bool {
-		return i >= 1 && i <= 2
-	}, 1)
+	coords, err := readCoordinateSys(reader)
 	if err != nil {
 		return err
 	}
@@ -26,15 +26,24 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, "An error occured:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	reader := bufio.NewReader(os.Stdin)
 	prompt := `Please select one of the following:
 1. AutoImages
 2. AutoVideos
 3. AutoAudio
-Please enter 1, 2, or 3 (default: 1): `
+4. AutoEvolve
+Please enter 1, 2, 3, or 4 (default: 1): `
 
 	option, err := readInt64(reader, prompt, func(i int64) bool {
-		return i >= 1 && i <= 3
+		return i >= 1 && i <= 4
 	}, 1)
 	if err != nil {
 		fmt.Println("Error reading user input:", err)
@@ -47,6 +56,8 @@ Please enter 1, 2, or 3 (default: 1): `
 		err = autoVideos(reader)
 	case 3:
 		err = autoAudio(reader)
+	case 4:
+		err = autoEvolve(reader)
 	}
 
 	if err != nil {